@@ -2,6 +2,7 @@ package conf
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -26,3 +27,27 @@ func (d *DurationRange) UnmarshalEnv(v string) error {
 	}
 	return nil
 }
+
+type IntRange struct {
+	Min, Max int
+}
+
+func (r *IntRange) UnmarshalEnv(v string) error {
+	values := strings.Split(v, "-")
+	if len(values) != 2 {
+		return fmt.Errorf("Expected IntRange to be of format {min}-{max}")
+	}
+	var err error
+	r.Min, err = strconv.Atoi(values[0])
+	if err != nil {
+		return fmt.Errorf("Error parsing IntRange.Min: %s", err)
+	}
+	r.Max, err = strconv.Atoi(values[1])
+	if err != nil {
+		return fmt.Errorf("Error parsing IntRange.Max: %s", err)
+	}
+	if r.Min > r.Max {
+		return fmt.Errorf("Expected IntRange.Min to be at most IntRange.Max")
+	}
+	return nil
+}
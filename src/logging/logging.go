@@ -0,0 +1,185 @@
+// Package logging provides leveled logging with structured fields, written
+// either as text or as one JSON object per line. Output, level and format
+// are process wide, so Loggers can be created at package level before the
+// binary has loaded its configuration.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+
+	return levelNames[l]
+}
+
+// UnmarshalEnv parses a level name: debug, info, warn or error.
+func (l *Level) UnmarshalEnv(v string) error {
+	for i, name := range levelNames {
+		if strings.EqualFold(v, name) {
+			*l = Level(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unknown log level: %s", v)
+}
+
+type Format int
+
+const (
+	Text Format = iota
+	JSON
+)
+
+// UnmarshalEnv parses a format name: text or json.
+func (f *Format) UnmarshalEnv(v string) error {
+	switch strings.ToLower(v) {
+	case "text":
+		*f = Text
+	case "json":
+		*f = JSON
+	default:
+		return fmt.Errorf("Unknown log format: %s", v)
+	}
+
+	return nil
+}
+
+var (
+	mu     sync.Mutex
+	out    io.Writer = os.Stderr
+	level            = Info
+	format           = Text
+)
+
+// SetOutput sets where every Logger writes to.
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+}
+
+// Configure sets the lowest level that is written and the output format.
+func Configure(l Level, f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	level = l
+	format = f
+}
+
+// Logger writes log lines with a fixed set of fields. It is safe for
+// concurrent use.
+type Logger struct {
+	fields map[string]interface{}
+}
+
+// New creates a Logger with a component field.
+func New(component string) *Logger {
+	return &Logger{
+		fields: map[string]interface{}{"component": component},
+	}
+}
+
+// With returns a Logger that adds the field to every line.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make(map[string]interface{}, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+
+	return &Logger{fields: fields}
+}
+
+func (l *Logger) Debugf(f string, args ...interface{}) { l.log(Debug, f, args...) }
+func (l *Logger) Infof(f string, args ...interface{})  { l.log(Info, f, args...) }
+func (l *Logger) Warnf(f string, args ...interface{})  { l.log(Warn, f, args...) }
+func (l *Logger) Errorf(f string, args ...interface{}) { l.log(Error, f, args...) }
+
+func (l *Logger) log(lvl Level, f string, args ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if lvl < level {
+		return
+	}
+
+	msg := fmt.Sprintf(f, args...)
+	t := time.Now().UTC()
+
+	var line []byte
+	if format == JSON {
+		line = l.jsonLine(t, lvl, msg)
+	} else {
+		line = l.textLine(t, lvl, msg)
+	}
+
+	out.Write(line)
+}
+
+func (l *Logger) jsonLine(t time.Time, lvl Level, msg string) []byte {
+	entry := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["timestamp"] = t.Format(time.RFC3339Nano)
+	entry["level"] = lvl.String()
+	entry["message"] = msg
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{
+			"timestamp": t.Format(time.RFC3339Nano),
+			"level":     lvl.String(),
+			"message":   msg,
+			"error":     fmt.Sprintf("unable to encode fields: %s", err),
+		})
+	}
+
+	return append(line, '\n')
+}
+
+func (l *Logger) textLine(t time.Time, lvl Level, msg string) []byte {
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := fmt.Sprintf("%s %s %s", t.Format(time.RFC3339Nano), strings.ToUpper(lvl.String()), msg)
+	for _, k := range keys {
+		v := fmt.Sprint(l.fields[k])
+		if strings.ContainsAny(v, " \"=") {
+			v = strconv.Quote(v)
+		}
+		line += fmt.Sprintf(" %s=%s", k, v)
+	}
+
+	return []byte(line + "\n")
+}
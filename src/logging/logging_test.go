@@ -0,0 +1,94 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		logging.SetOutput(out)
+	})
+
+	AfterEach(func() {
+		logging.SetOutput(GinkgoWriter)
+		logging.Configure(logging.Info, logging.Text)
+	})
+
+	It("writes JSON lines with the fields", func() {
+		logging.Configure(logging.Info, logging.JSON)
+
+		logging.New("egress").
+			With("addr", "localhost:3457").
+			With("error", errors.New("boom")).
+			Errorf("could not connect: %d", 1)
+
+		var line map[string]interface{}
+		Expect(json.Unmarshal(out.Bytes(), &line)).To(Succeed())
+		Expect(line).To(HaveKeyWithValue("level", "error"))
+		Expect(line).To(HaveKeyWithValue("message", "could not connect: 1"))
+		Expect(line).To(HaveKeyWithValue("component", "egress"))
+		Expect(line).To(HaveKeyWithValue("addr", "localhost:3457"))
+		Expect(line).To(HaveKeyWithValue("error", "boom"))
+		Expect(line).To(HaveKey("timestamp"))
+	})
+
+	It("writes text lines with sorted fields", func() {
+		logging.New("egress").With("addr", "localhost:3457").Infof("connected")
+
+		Expect(out.String()).To(MatchRegexp(
+			`^\S+ INFO connected addr=localhost:3457 component=egress\n$`,
+		))
+	})
+
+	It("quotes text field values with spaces", func() {
+		logging.New("egress").With("error", errors.New("no such host")).Warnf("retrying")
+
+		Expect(out.String()).To(ContainSubstring(`error="no such host"`))
+	})
+
+	It("does not change the logger With is called on", func() {
+		logging.Configure(logging.Info, logging.JSON)
+		l := logging.New("egress")
+		l.With("addr", "localhost:3457")
+
+		l.Infof("hello")
+
+		var line map[string]interface{}
+		Expect(json.Unmarshal(out.Bytes(), &line)).To(Succeed())
+		Expect(line).ToNot(HaveKey("addr"))
+	})
+
+	It("drops lines below the level", func() {
+		logging.Configure(logging.Warn, logging.Text)
+		l := logging.New("egress")
+
+		l.Debugf("debug")
+		l.Infof("info")
+		l.Warnf("warn")
+
+		Expect(out.String()).ToNot(ContainSubstring("DEBUG"))
+		Expect(out.String()).ToNot(ContainSubstring("INFO"))
+		Expect(out.String()).To(ContainSubstring("WARN warn"))
+	})
+
+	It("parses levels and formats", func() {
+		var l logging.Level
+		Expect(l.UnmarshalEnv("WARN")).To(Succeed())
+		Expect(l).To(Equal(logging.Warn))
+		Expect(l.UnmarshalEnv("verbose")).ToNot(Succeed())
+
+		var f logging.Format
+		Expect(f.UnmarshalEnv("json")).To(Succeed())
+		Expect(f).To(Equal(logging.JSON))
+		Expect(f.UnmarshalEnv("xml")).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"github.com/cloudfoundry/dropsonde/metricbatcher"
+)
+
+type MetricBatcher interface {
+	BatchCounter(name string) metricbatcher.BatchCounterChainer
+}
+
+// Batcher records every counter in a Registry as well as passing it on to
+// the wrapped MetricBatcher.
+type Batcher struct {
+	batcher  MetricBatcher
+	registry *Registry
+}
+
+func NewBatcher(b MetricBatcher, r *Registry) *Batcher {
+	return &Batcher{
+		batcher:  b,
+		registry: r,
+	}
+}
+
+func (b *Batcher) BatchCounter(name string) metricbatcher.BatchCounterChainer {
+	return &chainer{
+		name:     name,
+		tags:     make(map[string]string),
+		chainer:  b.batcher.BatchCounter(name),
+		registry: b.registry,
+	}
+}
+
+type chainer struct {
+	name     string
+	tags     map[string]string
+	chainer  metricbatcher.BatchCounterChainer
+	registry *Registry
+}
+
+func (c *chainer) SetTag(key, value string) metricbatcher.BatchCounterChainer {
+	c.tags[key] = value
+	c.chainer = c.chainer.SetTag(key, value)
+	return c
+}
+
+func (c *chainer) Increment() {
+	c.Add(1)
+}
+
+func (c *chainer) Add(value uint64) {
+	c.registry.Add(c.name, c.tags, value)
+	c.chainer.Add(value)
+}
@@ -0,0 +1,95 @@
+package metrics_test
+
+import (
+	"bytes"
+	"metrics"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry/dropsonde/metricbatcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var r *metrics.Registry
+
+	BeforeEach(func() {
+		r = metrics.NewRegistry()
+	})
+
+	It("writes counters and gauges in the Prometheus text format", func() {
+		r.Add("volley.openConnections", map[string]string{"conn_type": "firehose"}, 2)
+		r.Add("volley.openConnections", map[string]string{"conn_type": "firehose"}, 3)
+		r.Add("volley.openConnections", map[string]string{"conn_type": "stream"}, 1)
+		r.Set("loop_latency_p99", nil, 12.5)
+
+		var b bytes.Buffer
+		_, err := r.WriteTo(&b)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(b.String()).To(Equal(`# TYPE loop_latency_p99 gauge
+loop_latency_p99 12.5
+# TYPE volley_openConnections counter
+volley_openConnections{conn_type="firehose"} 5
+volley_openConnections{conn_type="stream"} 1
+`))
+	})
+
+	It("escapes label values", func() {
+		r.Add("receivedBytes", map[string]string{"path": "a\"b\\c\nd"}, 1)
+
+		var b bytes.Buffer
+		r.WriteTo(&b)
+
+		Expect(b.String()).To(ContainSubstring(`receivedBytes{path="a\"b\\c\nd"} 1`))
+	})
+
+	It("serves the metrics over HTTP", func() {
+		r.Add("handleConn", nil, 1)
+		rw := httptest.NewRecorder()
+
+		r.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Header().Get("Content-Type")).To(ContainSubstring("text/plain"))
+		Expect(rw.Body.String()).To(ContainSubstring("handleConn 1\n"))
+	})
+})
+
+var _ = Describe("Batcher", func() {
+	It("records counters and passes them on", func() {
+		r := metrics.NewRegistry()
+		spy := &spyBatcher{}
+		b := metrics.NewBatcher(spy, r)
+
+		b.BatchCounter("receivedBytes").SetTag("protocol", "https").Add(10)
+		b.BatchCounter("receivedBytes").SetTag("protocol", "https").Increment()
+
+		Expect(spy.total).To(Equal(uint64(11)))
+		Expect(spy.tags).To(Equal(map[string]string{"protocol": "https"}))
+
+		var out bytes.Buffer
+		r.WriteTo(&out)
+		Expect(out.String()).To(ContainSubstring(`receivedBytes{protocol="https"} 11`))
+	})
+})
+
+type spyBatcher struct {
+	total uint64
+	tags  map[string]string
+}
+
+func (s *spyBatcher) BatchCounter(string) metricbatcher.BatchCounterChainer {
+	s.tags = make(map[string]string)
+	return s
+}
+
+func (s *spyBatcher) SetTag(k, v string) metricbatcher.BatchCounterChainer {
+	s.tags[k] = v
+	return s
+}
+
+func (s *spyBatcher) Increment()   { s.total++ }
+func (s *spyBatcher) Add(v uint64) { s.total += v }
@@ -0,0 +1,156 @@
+// Package metrics keeps counters and gauges in memory and serves them in
+// the Prometheus text format, so load generators can be observed without
+// going through the Loggregator they are loading.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	counterType = "counter"
+	gaugeType   = "gauge"
+)
+
+// Registry holds metrics by name and tags. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	metricType string
+	series     map[string]*series
+}
+
+type series struct {
+	labels string
+	value  float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// Add increases the counter with the name and tags by delta.
+func (r *Registry) Add(name string, tags map[string]string, delta uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.series(name, counterType, tags).value += float64(delta)
+}
+
+// Set sets the gauge with the name and tags to value.
+func (r *Registry) Set(name string, tags map[string]string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.series(name, gaugeType, tags).value = value
+}
+
+func (r *Registry) series(name, metricType string, tags map[string]string) *series {
+	name = sanitize(name)
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{
+			metricType: metricType,
+			series:     make(map[string]*series),
+		}
+		r.families[name] = f
+	}
+
+	labels := formatLabels(tags)
+	s, ok := f.series[labels]
+	if !ok {
+		s = &series{labels: labels}
+		f.series[labels] = s
+	}
+
+	return s
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.metricType)
+
+		labels := make([]string, 0, len(f.series))
+		for l := range f.series {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+
+		for _, l := range labels {
+			fmt.Fprintf(&b, "%s%s %v\n", name, l, f.series[l].value)
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics, e.g. on /metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteTo(w)
+}
+
+// ListenAndServe serves the registry on /metrics until the listener fails.
+func ListenAndServe(addr string, r *Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	return http.ListenAndServe(addr, mux)
+}
+
+var invalidChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// sanitize turns a dropsonde metric name such as volley.openConnections
+// into a valid Prometheus name such as volley_openConnections.
+func sanitize(name string) string {
+	name = invalidChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, sanitize(k), labelEscaper.Replace(tags[k])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
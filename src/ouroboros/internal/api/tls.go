@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 
 	"google.golang.org/grpc/credentials"
 )
@@ -84,7 +83,7 @@ func addCA(tlsConfig *tls.Config, tlsCert tls.Certificate, caCertFile string) er
 	return nil
 }
 
-func NewCredentials(certFile, keyFile, caCertFile, serverName string) credentials.TransportCredentials {
+func NewCredentials(certFile, keyFile, caCertFile, serverName string) (credentials.TransportCredentials, error) {
 	tlsConfig, err := NewMutualTLSConfig(
 		certFile,
 		keyFile,
@@ -93,9 +92,8 @@ func NewCredentials(certFile, keyFile, caCertFile, serverName string) credential
 	)
 
 	if err != nil {
-		log.Printf("failed to create mutual tls config: %v", err)
-		return nil
+		return nil, fmt.Errorf("failed to create mutual tls config: %s", err)
 	}
 
-	return credentials.NewTLS(tlsConfig)
+	return credentials.NewTLS(tlsConfig), nil
 }
@@ -2,6 +2,7 @@ package egress_test
 
 import (
 	"log"
+	"logging"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
@@ -10,6 +11,7 @@ import (
 
 func TestEgress(t *testing.T) {
 	log.SetOutput(GinkgoWriter)
+	logging.SetOutput(GinkgoWriter)
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Ouroboros - Egress V1 Suite")
 }
@@ -0,0 +1,108 @@
+package egress_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/gomega"
+)
+
+type testTCPListener struct {
+	lis  net.Listener
+	msgs chan *events.Envelope
+}
+
+func newTestTCPListener(tlsConfig *tls.Config) *testTCPListener {
+	var (
+		lis net.Listener
+		err error
+	)
+	if tlsConfig != nil {
+		lis, err = tls.Listen("tcp", "localhost:0", tlsConfig)
+	} else {
+		lis, err = net.Listen("tcp", "localhost:0")
+	}
+	Expect(err).ToNot(HaveOccurred())
+
+	t := &testTCPListener{
+		lis:  lis,
+		msgs: make(chan *events.Envelope, 100),
+	}
+	go t.accept()
+
+	return t
+}
+
+func (t *testTCPListener) Addr() string {
+	return t.lis.Addr().String()
+}
+
+func (t *testTCPListener) Close() {
+	t.lis.Close()
+}
+
+func (t *testTCPListener) accept() {
+	for {
+		conn, err := t.lis.Accept()
+		if err != nil {
+			return
+		}
+		go t.read(conn)
+	}
+}
+
+func (t *testTCPListener) read(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var size uint32
+		if err := binary.Read(conn, binary.LittleEndian, &size); err != nil {
+			return
+		}
+
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+
+		var e events.Envelope
+		if err := proto.Unmarshal(buf, &e); err != nil {
+			return
+		}
+
+		t.msgs <- &e
+	}
+}
+
+func selfSignedTLSConfig() *tls.Config {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).ToNot(HaveOccurred())
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "metron"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}},
+	}
+}
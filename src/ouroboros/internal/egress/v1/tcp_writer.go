@@ -0,0 +1,103 @@
+package egress
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"logging"
+	"net"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+)
+
+// TCPWriter sends dropsonde envelopes over a TCP connection, or a TLS
+// connection when it is given a tls.Config. Each envelope is prefixed with
+// its length as a little endian uint32, which is the framing Metron's TLS
+// listener expects.
+type TCPWriter struct {
+	addr         string
+	tlsConfig    *tls.Config
+	writeTimeout time.Duration
+	conn         net.Conn
+	logger       *logging.Logger
+}
+
+// NewTCPWriter creates a TCPWriter. A nil tlsConfig sends envelopes over
+// plain TCP. A write that takes longer than writeTimeout fails, so a Metron
+// that stops reading does not block the writer.
+func NewTCPWriter(addr string, tlsConfig *tls.Config, writeTimeout time.Duration) *TCPWriter {
+	connType := "tcp"
+	if tlsConfig != nil {
+		connType = "tls"
+	}
+
+	return &TCPWriter{
+		addr:         addr,
+		tlsConfig:    tlsConfig,
+		writeTimeout: writeTimeout,
+		logger: logging.New("egress").
+			With("conn_type", connType).
+			With("addr", addr),
+	}
+}
+
+// Write sends the envelope, dialing Metron if there is no open connection.
+// If the dial or the write fails, or the write times out, the envelope is
+// dropped and the connection is dialed again on the next write.
+func (w *TCPWriter) Write(e *events.Envelope) {
+	data, err := proto.Marshal(e)
+	if err != nil {
+		w.logger.With("error", err).Errorf("Unable to marshal envelope")
+		return
+	}
+
+	if err := w.setupConn(); err != nil {
+		w.logger.With("error", err).Errorf("could not connect to metron")
+		return
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+	if _, err := w.conn.Write(frame); err != nil {
+		w.logger.With("error", err).Errorf("Unable to write to metron")
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// Close closes the connection to Metron.
+func (w *TCPWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *TCPWriter) setupConn() error {
+	if w.conn != nil {
+		return nil
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if w.tlsConfig != nil {
+		conn, err = tls.Dial("tcp", w.addr, w.tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", w.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.conn = conn
+	return nil
+}
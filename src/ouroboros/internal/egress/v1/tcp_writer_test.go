@@ -0,0 +1,112 @@
+package egress_test
+
+import (
+	"crypto/tls"
+	"net"
+	egress "ouroboros/internal/egress/v1"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TCPWriter", func() {
+	var (
+		listener *testTCPListener
+		e        *events.Envelope
+	)
+
+	BeforeEach(func() {
+		e = &events.Envelope{
+			Origin:    proto.String("some-origin"),
+			Timestamp: proto.Int64(99),
+			EventType: events.Envelope_LogMessage.Enum(),
+		}
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	Context("over TCP", func() {
+		BeforeEach(func() {
+			listener = newTestTCPListener(nil)
+		})
+
+		It("sends length prefixed envelopes", func() {
+			w := egress.NewTCPWriter(listener.Addr(), nil, time.Second)
+			w.Write(e)
+			w.Write(e)
+
+			var outEnv *events.Envelope
+			Eventually(listener.msgs).Should(Receive(&outEnv))
+			Expect(outEnv.GetOrigin()).To(Equal("some-origin"))
+			Eventually(listener.msgs).Should(Receive())
+		})
+
+		It("drops envelopes while metron is unreachable", func() {
+			listener.Close()
+			w := egress.NewTCPWriter(listener.Addr(), nil, time.Second)
+
+			Expect(func() { w.Write(e) }).ToNot(Panic())
+		})
+
+		It("reconnects once a write times out", func() {
+			lis, err := net.Listen("tcp", "localhost:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer lis.Close()
+			conns := make(chan net.Conn, 10)
+			go func() {
+				for {
+					conn, err := lis.Accept()
+					if err != nil {
+						return
+					}
+					// The connection is never read from.
+					conns <- conn
+				}
+			}()
+
+			w := egress.NewTCPWriter(lis.Addr().String(), nil, 100*time.Millisecond)
+			big := &events.Envelope{
+				Origin:    proto.String("some-origin"),
+				EventType: events.Envelope_LogMessage.Enum(),
+				LogMessage: &events.LogMessage{
+					Message:     make([]byte, 16*1024*1024),
+					MessageType: events.LogMessage_OUT.Enum(),
+					Timestamp:   proto.Int64(99),
+				},
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				w.Write(big)
+				w.Write(e)
+			}()
+
+			Eventually(done, 5).Should(BeClosed())
+			Eventually(conns).Should(HaveLen(2))
+		})
+	})
+
+	Context("over TLS", func() {
+		BeforeEach(func() {
+			listener = newTestTCPListener(selfSignedTLSConfig())
+		})
+
+		It("sends length prefixed envelopes", func() {
+			w := egress.NewTCPWriter(listener.Addr(), &tls.Config{
+				InsecureSkipVerify: true,
+			}, time.Second)
+			w.Write(e)
+
+			var outEnv *events.Envelope
+			Eventually(listener.msgs).Should(Receive(&outEnv))
+			Expect(outEnv.GetOrigin()).To(Equal("some-origin"))
+		})
+	})
+})
@@ -1,7 +1,7 @@
 package egress
 
 import (
-	"log"
+	"logging"
 	"net"
 
 	"github.com/cloudfoundry/sonde-go/events"
@@ -9,42 +9,53 @@ import (
 )
 
 type Writer struct {
-	addr string
-	conn *net.UDPConn
+	conn   *net.UDPConn
+	logger *logging.Logger
 }
 
-func NewWriter(addr string) *Writer {
-	return &Writer{
-		addr: addr,
-	}
-}
-
-func (w *Writer) Write(e *events.Envelope) {
-	w.setupConn()
-
-	data, err := proto.Marshal(e)
+// NewWriter resolves the address and opens a UDP socket to it. The address
+// is only resolved once, so an invalid address is reported here rather than
+// on every write.
+func NewWriter(addr string) (*Writer, error) {
+	ra, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
-		log.Fatalf("Unable to marshal envelope (%+v): %s", e, err)
+		return nil, err
 	}
 
-	_, err = w.conn.Write(data)
+	conn, err := net.DialUDP("udp", nil, ra)
 	if err != nil {
-		log.Fatalf("Unable to write to UDP: %s", err)
+		return nil, err
 	}
+
+	return &Writer{
+		conn: conn,
+		logger: logging.New("egress").
+			With("conn_type", "udp").
+			With("addr", addr),
+	}, nil
 }
 
-func (w *Writer) setupConn() {
-	if w.conn != nil {
+// Write sends the envelope to Metron. If it cannot be sent the failure is
+// logged and the envelope is dropped.
+func (w *Writer) Write(e *events.Envelope) {
+	data, err := proto.Marshal(e)
+	if err != nil {
+		w.logger.With("error", err).Errorf("Unable to marshal envelope")
 		return
 	}
 
-	ra, err := net.ResolveUDPAddr("udp", w.addr)
-	if err != nil {
-		log.Fatalf("Invalid addr (%s): %s", w.addr, err)
+	if _, err := w.conn.Write(data); err != nil {
+		w.logger.With("error", err).Errorf("Unable to write to UDP")
 	}
+}
 
-	w.conn, err = net.DialUDP("udp", nil, ra)
-	if err != nil {
-		log.Fatalf("could not connect to metron: %s", err)
+// Close closes the UDP socket.
+func (w *Writer) Close() error {
+	if w.conn == nil {
+		return nil
 	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
 }
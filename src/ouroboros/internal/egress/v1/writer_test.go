@@ -22,7 +22,9 @@ var _ = Describe("UdpWriter", func() {
 		}
 		udpAddr := udpListener.Listen()
 
-		udpWriter = egress.NewWriter(udpAddr)
+		var err error
+		udpWriter, err = egress.NewWriter(udpAddr)
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	It("sends the envelope over UDP", func() {
@@ -38,4 +40,10 @@ var _ = Describe("UdpWriter", func() {
 		Eventually(udpListener.msgs).Should(Receive(&outEnv))
 		Expect(outEnv.GetOrigin()).To(Equal("some-origin"))
 	})
+
+	It("returns an error for an address it cannot resolve", func() {
+		_, err := egress.NewWriter("not-an-addr")
+
+		Expect(err).To(HaveOccurred())
+	})
 })
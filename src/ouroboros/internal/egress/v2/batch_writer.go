@@ -0,0 +1,221 @@
+package egress
+
+import (
+	"conf"
+	"context"
+	"errors"
+	"logging"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+
+	loggregator "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	"google.golang.org/grpc"
+)
+
+// BatchWriter spreads envelopes over a pool of BatchSender streams. Each
+// stream sends a batch once it holds batchSize envelopes or once the flush
+// interval has passed, whichever comes first. A stream that breaks is
+// reopened with an exponential backoff bounded by the configured range,
+// whose minimum must be above 0.
+type BatchWriter struct {
+	conn      *grpc.ClientConn
+	converter Converter
+	streams   []*batchStream
+	next      int
+}
+
+func NewBatchWriter(
+	addr string,
+	c Converter,
+	streamCount int,
+	batchSize int,
+	flushInterval time.Duration,
+	backoff conf.DurationRange,
+	dialOpts ...grpc.DialOption,
+) (*BatchWriter, error) {
+	if backoff.Min <= 0 || backoff.Min > backoff.Max {
+		return nil, errors.New("backoff min must be above 0 and at most max")
+	}
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	client := loggregator.NewIngressClient(conn)
+	logger := logging.New("egress").
+		With("conn_type", "grpc_batch").
+		With("addr", addr)
+
+	w := &BatchWriter{conn: conn, converter: c}
+	for i := 0; i < streamCount; i++ {
+		s := &batchStream{
+			client:        client,
+			envelopes:     make(chan *loggregator.Envelope, batchSize),
+			batchSize:     batchSize,
+			flushInterval: flushInterval,
+			backoff:       backoff,
+			done:          make(chan struct{}),
+			stopped:       make(chan struct{}),
+			logger:        logger.With("stream", i),
+		}
+		go s.run()
+
+		w.streams = append(w.streams, s)
+	}
+
+	return w, nil
+}
+
+// Write hands the envelope to the next stream in the pool. It blocks while
+// that stream is reconnecting and its buffer is full.
+func (w *BatchWriter) Write(msg *events.Envelope) {
+	w.WriteV2(w.converter.ToV2(msg))
+}
+
+// WriteV2 hands a V2 envelope to the next stream in the pool without
+// converting it.
+func (w *BatchWriter) WriteV2(e *loggregator.Envelope) {
+	s := w.streams[w.next]
+	w.next = (w.next + 1) % len(w.streams)
+
+	s.envelopes <- e
+}
+
+// Close flushes the envelopes buffered by every stream, closes the streams
+// and then the connection. Envelopes that cannot be flushed on the first
+// attempt are dropped.
+func (w *BatchWriter) Close() error {
+	for _, s := range w.streams {
+		close(s.done)
+	}
+	for _, s := range w.streams {
+		<-s.stopped
+	}
+
+	return w.conn.Close()
+}
+
+type batchStream struct {
+	client        loggregator.IngressClient
+	sender        loggregator.Ingress_BatchSenderClient
+	envelopes     chan *loggregator.Envelope
+	batchSize     int
+	flushInterval time.Duration
+	backoff       conf.DurationRange
+	done          chan struct{}
+	stopped       chan struct{}
+	logger        *logging.Logger
+}
+
+func (s *batchStream) run() {
+	defer close(s.stopped)
+
+	t := time.NewTicker(s.flushInterval)
+	defer t.Stop()
+
+	batch := make([]*loggregator.Envelope, 0, s.batchSize)
+	for {
+		select {
+		case e := <-s.envelopes:
+			batch = append(batch, e)
+			if len(batch) < s.batchSize {
+				continue
+			}
+		case <-t.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-s.done:
+			s.drain(batch)
+			return
+		}
+
+		if !s.send(batch) {
+			s.drain(batch)
+			return
+		}
+		batch = batch[:0]
+	}
+}
+
+// send retries the batch until it is accepted by a stream, reopening the
+// stream as needed. It gives up and returns false once the writer is
+// closed.
+func (s *batchStream) send(batch []*loggregator.Envelope) bool {
+	delay := s.backoff.Min
+	for {
+		err := s.trySend(batch)
+		if err == nil {
+			return true
+		}
+
+		s.logger.With("error", err).Warnf("Failed to send V2 envelope batch, reconnecting in %s", delay)
+		select {
+		case <-time.After(delay):
+		case <-s.done:
+			return false
+		}
+
+		delay *= 2
+		if delay > s.backoff.Max {
+			delay = s.backoff.Max
+		}
+	}
+}
+
+// drain makes a single attempt to send the batch and everything still
+// buffered, and then closes the stream.
+func (s *batchStream) drain(batch []*loggregator.Envelope) {
+	for drained := false; !drained; {
+		select {
+		case e := <-s.envelopes:
+			batch = append(batch, e)
+		default:
+			drained = true
+		}
+	}
+
+	for len(batch) > 0 {
+		n := s.batchSize
+		if n > len(batch) {
+			n = len(batch)
+		}
+
+		if err := s.trySend(batch[:n]); err != nil {
+			s.logger.With("error", err).Errorf("Dropped %d V2 envelopes on shutdown", len(batch))
+			break
+		}
+		batch = batch[n:]
+	}
+
+	if s.sender != nil {
+		if _, err := s.sender.CloseAndRecv(); err != nil {
+			s.logger.With("error", err).Warnf("Failed to close V2 envelope batch stream")
+		}
+		s.sender = nil
+	}
+}
+
+func (s *batchStream) trySend(batch []*loggregator.Envelope) error {
+	if s.sender == nil {
+		sender, err := s.client.BatchSender(context.Background(), grpc.FailFast(true))
+		if err != nil {
+			return err
+		}
+		s.sender = sender
+	}
+
+	err := s.sender.Send(&loggregator.EnvelopeBatch{Batch: batch})
+	if err != nil {
+		// The error from Send is io.EOF when the stream is broken. The
+		// reason the stream broke is returned by CloseAndRecv.
+		if _, closeErr := s.sender.CloseAndRecv(); closeErr != nil {
+			err = closeErr
+		}
+		s.sender = nil
+	}
+
+	return err
+}
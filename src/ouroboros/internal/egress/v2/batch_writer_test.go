@@ -0,0 +1,189 @@
+package egress_test
+
+import (
+	"conf"
+	"errors"
+	"io"
+	egress "ouroboros/internal/egress/v2"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BatchWriter", func() {
+	var (
+		ingressAddr   string
+		mockServer    *mockIngressServer
+		mockConverter *mockConverter
+		e             *events.Envelope
+		done          chan struct{}
+	)
+
+	BeforeEach(func() {
+		mockServer, ingressAddr = startIngressServer()
+		mockConverter = newMockConverter()
+		done = make(chan struct{})
+
+		c, stop := mockConverter, done
+		go func() {
+			for {
+				select {
+				case c.ToV2Output.V2e <- &loggregator.Envelope{Timestamp: 99}:
+				case <-stop:
+					return
+				}
+				select {
+				case <-c.ToV2Called:
+				case <-stop:
+					return
+				}
+				<-c.ToV2Input.V1e
+			}
+		}()
+
+		e = &events.Envelope{
+			Origin:    proto.String("some-origin"),
+			Timestamp: proto.Int64(99),
+			EventType: events.Envelope_LogMessage.Enum(),
+		}
+	})
+
+	AfterEach(func() {
+		close(done)
+	})
+
+	newBatchWriter := func(streams, batchSize int, flushInterval time.Duration) *egress.BatchWriter {
+		w, err := egress.NewBatchWriter(
+			ingressAddr,
+			mockConverter,
+			streams,
+			batchSize,
+			flushInterval,
+			conf.DurationRange{Min: time.Millisecond, Max: 10 * time.Millisecond},
+			grpc.WithInsecure(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		return w
+	}
+
+	It("sends a batch once it reaches the batch size", func() {
+		w := newBatchWriter(1, 5, time.Hour)
+		for i := 0; i < 5; i++ {
+			w.Write(e)
+		}
+
+		var sender loggregator.Ingress_BatchSenderServer
+		Eventually(mockServer.BatchSenderInput.Arg0).Should(Receive(&sender))
+
+		batch, err := sender.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(batch.Batch).To(HaveLen(5))
+		Expect(batch.Batch[0].Timestamp).To(Equal(int64(99)))
+	})
+
+	It("flushes a partial batch after the flush interval", func() {
+		w := newBatchWriter(1, 100, 10*time.Millisecond)
+		w.Write(e)
+		w.Write(e)
+
+		var sender loggregator.Ingress_BatchSenderServer
+		Eventually(mockServer.BatchSenderInput.Arg0).Should(Receive(&sender))
+
+		batch, err := sender.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(batch.Batch).To(HaveLen(2))
+	})
+
+	It("sends V2 envelopes without converting them", func() {
+		w := newBatchWriter(1, 1, time.Hour)
+		w.WriteV2(&loggregator.Envelope{SourceId: "some-source", Timestamp: 42})
+
+		var sender loggregator.Ingress_BatchSenderServer
+		Eventually(mockServer.BatchSenderInput.Arg0).Should(Receive(&sender))
+
+		batch, err := sender.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(batch.Batch).To(HaveLen(1))
+		Expect(batch.Batch[0].SourceId).To(Equal("some-source"))
+		Expect(batch.Batch[0].Timestamp).To(Equal(int64(42)))
+	})
+
+	It("spreads envelopes over the pool of streams", func() {
+		w := newBatchWriter(3, 1, time.Hour)
+		for i := 0; i < 3; i++ {
+			w.Write(e)
+		}
+
+		Eventually(mockServer.BatchSenderCalled).Should(HaveLen(3))
+	})
+
+	It("flushes buffered envelopes and closes the stream when closed", func() {
+		w := newBatchWriter(1, 100, time.Hour)
+		w.Write(e)
+		w.Write(e)
+
+		closed := make(chan error, 1)
+		go func() { closed <- w.Close() }()
+
+		var sender loggregator.Ingress_BatchSenderServer
+		Eventually(mockServer.BatchSenderInput.Arg0).Should(Receive(&sender))
+
+		batch, err := sender.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(batch.Batch).To(HaveLen(2))
+
+		_, err = sender.Recv()
+		Expect(err).To(Equal(io.EOF))
+
+		mockServer.BatchSenderOutput.Ret0 <- nil
+		Eventually(closed).Should(Receive(BeNil()))
+	})
+
+	It("rejects a backoff that starts at 0", func() {
+		for _, b := range []conf.DurationRange{
+			{Min: 0, Max: time.Second},
+			{Min: time.Second, Max: time.Millisecond},
+		} {
+			_, err := egress.NewBatchWriter(ingressAddr, mockConverter, 1, 1, time.Hour, b, grpc.WithInsecure())
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("reopens a stream that breaks", func() {
+		w := newBatchWriter(1, 1, time.Hour)
+		w.Write(e)
+
+		var sender loggregator.Ingress_BatchSenderServer
+		Eventually(mockServer.BatchSenderInput.Arg0).Should(Receive(&sender))
+		_, err := sender.Recv()
+		Expect(err).ToNot(HaveOccurred())
+
+		mockServer.BatchSenderOutput.Ret0 <- errors.New("stream broke")
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					w.Write(e)
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}()
+
+		Eventually(mockServer.BatchSenderInput.Arg0).Should(Receive(&sender))
+		batch, err := sender.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(batch.Batch).To(HaveLen(1))
+	})
+})
@@ -2,7 +2,7 @@ package egress
 
 import (
 	"context"
-	"log"
+	"logging"
 
 	"github.com/cloudfoundry/sonde-go/events"
 
@@ -16,33 +16,83 @@ type Converter interface {
 }
 
 type Writer struct {
+	conn      *grpc.ClientConn
+	client    loggregator.IngressClient
 	sender    loggregator.Ingress_SenderClient
 	converter Converter
 	count     int
+	logger    *logging.Logger
 }
 
-func NewWriter(addr string, c Converter, dialOpts ...grpc.DialOption) *Writer {
+func NewWriter(addr string, c Converter, dialOpts ...grpc.DialOption) (*Writer, error) {
 	conn, err := grpc.Dial(addr, dialOpts...)
 	if err != nil {
-		log.Fatalf("Failed to dial Loggregator V2 API: %s", err)
+		return nil, err
 	}
 
-	client := loggregator.NewIngressClient(conn)
-	sender, err := client.Sender(context.Background(), grpc.FailFast(true))
-	if err != nil {
-		log.Fatalf("Failed to open Loggregator V2 ingress stream: %s", err)
+	w := &Writer{
+		conn:      conn,
+		client:    loggregator.NewIngressClient(conn),
+		converter: c,
+		logger: logging.New("egress").
+			With("conn_type", "grpc").
+			With("addr", addr),
+	}
+
+	if err := w.openStream(); err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	return &Writer{sender: sender, converter: c}
+	return w, nil
 }
 
+// Close closes the stream, waiting for Loggregator to acknowledge it, and
+// then the connection.
+func (w *Writer) Close() error {
+	var err error
+	if w.sender != nil {
+		_, err = w.sender.CloseAndRecv()
+	}
+	w.conn.Close()
+	return err
+}
+
+// Write sends the envelope over the stream. If the stream is broken the
+// envelope is dropped and the stream is reopened on the next write.
 func (w *Writer) Write(msg *events.Envelope) {
-	if err := w.sender.Send(w.converter.ToV2(msg)); err != nil {
-		log.Fatalf("Failed to send V2 envelope: %s", err)
+	w.WriteV2(w.converter.ToV2(msg))
+}
+
+// WriteV2 sends a V2 envelope over the stream without converting it.
+func (w *Writer) WriteV2(e *loggregator.Envelope) {
+	if err := w.openStream(); err != nil {
+		w.logger.With("error", err).Errorf("Failed to open Loggregator V2 ingress stream")
+		return
+	}
+
+	if err := w.sender.Send(e); err != nil {
+		w.logger.With("error", err).Errorf("Failed to send V2 envelope")
+		w.sender = nil
+		return
 	}
 
 	w.count++
 	if w.count%1000 == 0 {
-		log.Print("Egressed 1000 envelopes")
+		w.logger.Infof("Egressed 1000 envelopes")
+	}
+}
+
+func (w *Writer) openStream() error {
+	if w.sender != nil {
+		return nil
 	}
+
+	sender, err := w.client.Sender(context.Background(), grpc.FailFast(true))
+	if err != nil {
+		return err
+	}
+
+	w.sender = sender
+	return nil
 }
@@ -37,7 +37,9 @@ var _ = Describe("Writer", func() {
 			}
 		}()
 
-		v2Writer = egress.NewWriter(ingressAddr, mockConverter, grpc.WithInsecure())
+		var err error
+		v2Writer, err = egress.NewWriter(ingressAddr, mockConverter, grpc.WithInsecure())
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	It("sends the envelope to the Sender stream", func(done Done) {
@@ -0,0 +1,145 @@
+package filter
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+type EnvelopeWriter interface {
+	Write(e *events.Envelope)
+}
+
+// Filter reports whether an envelope should be passed on to the next
+// writer.
+type Filter func(e *events.Envelope) bool
+
+// Transform modifies an envelope before it is passed on to the next
+// writer. It may change the envelope in place.
+type Transform func(e *events.Envelope) *events.Envelope
+
+// Chain is an EnvelopeWriter that only writes envelopes which pass every
+// filter, after applying its transforms to them.
+type Chain struct {
+	filters    []Filter
+	transforms []Transform
+	writer     EnvelopeWriter
+}
+
+// NewChain creates a Chain that applies the filters and then the transforms
+// in order. An envelope rejected by one filter is not seen by the filters
+// after it.
+func NewChain(w EnvelopeWriter, transforms []Transform, filters ...Filter) *Chain {
+	return &Chain{
+		filters:    filters,
+		transforms: transforms,
+		writer:     w,
+	}
+}
+
+func (c *Chain) Write(e *events.Envelope) {
+	for _, f := range c.filters {
+		if !f(e) {
+			return
+		}
+	}
+
+	for _, t := range c.transforms {
+		e = t(e)
+	}
+
+	c.writer.Write(e)
+}
+
+// EventTypes keeps envelopes of any of the given event types.
+func EventTypes(types ...events.Envelope_EventType) Filter {
+	keep := make(map[events.Envelope_EventType]bool)
+	for _, t := range types {
+		keep[t] = true
+	}
+
+	return func(e *events.Envelope) bool {
+		return keep[e.GetEventType()]
+	}
+}
+
+// Origins keeps envelopes from any of the given origins.
+func Origins(origins ...string) Filter {
+	return matchAny(origins, (*events.Envelope).GetOrigin)
+}
+
+// Deployments keeps envelopes from any of the given deployments.
+func Deployments(deployments ...string) Filter {
+	return matchAny(deployments, (*events.Envelope).GetDeployment)
+}
+
+// Jobs keeps envelopes from any of the given jobs.
+func Jobs(jobs ...string) Filter {
+	return matchAny(jobs, (*events.Envelope).GetJob)
+}
+
+// Tag keeps envelopes that have the named tag with a value matching the
+// pattern.
+func Tag(name string, pattern *regexp.Regexp) Filter {
+	return func(e *events.Envelope) bool {
+		v, ok := e.GetTags()[name]
+		return ok && pattern.MatchString(v)
+	}
+}
+
+// Sample keeps roughly the given percentage of envelopes.
+func Sample(percent float64) Filter {
+	return func(*events.Envelope) bool {
+		return rand.Float64()*100 < percent
+	}
+}
+
+// SetOrigin replaces the origin of every envelope.
+func SetOrigin(origin string) Transform {
+	return func(e *events.Envelope) *events.Envelope {
+		e.Origin = &origin
+		return e
+	}
+}
+
+// AddTags sets the given tags on every envelope, replacing tags with the
+// same name.
+func AddTags(tags map[string]string) Transform {
+	return func(e *events.Envelope) *events.Envelope {
+		if e.Tags == nil {
+			e.Tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			e.Tags[k] = v
+		}
+		return e
+	}
+}
+
+func matchAny(values []string, field func(*events.Envelope) string) Filter {
+	keep := make(map[string]bool)
+	for _, v := range values {
+		keep[v] = true
+	}
+
+	return func(e *events.Envelope) bool {
+		return keep[field(e)]
+	}
+}
+
+// ParseEventTypes converts event type names such as "LogMessage" into
+// their envelope event types.
+func ParseEventTypes(names []string) ([]events.Envelope_EventType, error) {
+	var types []events.Envelope_EventType
+	for _, n := range names {
+		t, ok := events.Envelope_EventType_value[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown event type: %s", n)
+		}
+		types = append(types, events.Envelope_EventType(t))
+	}
+
+	return types, nil
+}
@@ -0,0 +1,164 @@
+package filter_test
+
+import (
+	"ouroboros/internal/filter"
+	"regexp"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chain", func() {
+	var (
+		writer *spyEnvelopeWriter
+	)
+
+	BeforeEach(func() {
+		writer = newSpyEnvelopeWriter()
+	})
+
+	It("writes every envelope without filters", func() {
+		c := filter.NewChain(writer, nil)
+
+		c.Write(newEnvelope(events.Envelope_LogMessage))
+
+		Expect(writer.envelopes).To(HaveLen(1))
+	})
+
+	It("only writes envelopes that pass every filter", func() {
+		c := filter.NewChain(
+			writer,
+			nil,
+			filter.EventTypes(events.Envelope_LogMessage),
+			filter.Origins("some-origin"),
+		)
+
+		e := newEnvelope(events.Envelope_LogMessage)
+		c.Write(e)
+		c.Write(newEnvelope(events.Envelope_ValueMetric))
+
+		other := newEnvelope(events.Envelope_LogMessage)
+		other.Origin = proto.String("other-origin")
+		c.Write(other)
+
+		Expect(writer.envelopes).To(ConsistOf(e))
+	})
+
+	It("filters by deployment and job", func() {
+		c := filter.NewChain(
+			writer,
+			nil,
+			filter.Deployments("cf", "other-deployment"),
+			filter.Jobs("diego-cell"),
+		)
+
+		e := newEnvelope(events.Envelope_ContainerMetric)
+		e.Deployment = proto.String("cf")
+		e.Job = proto.String("diego-cell")
+		c.Write(e)
+
+		other := newEnvelope(events.Envelope_ContainerMetric)
+		other.Deployment = proto.String("cf")
+		other.Job = proto.String("router")
+		c.Write(other)
+
+		Expect(writer.envelopes).To(ConsistOf(e))
+	})
+
+	It("filters by tag pattern", func() {
+		c := filter.NewChain(
+			writer,
+			nil,
+			filter.Tag("source_id", regexp.MustCompile("^app-")),
+		)
+
+		e := newEnvelope(events.Envelope_LogMessage)
+		e.Tags = map[string]string{"source_id": "app-1"}
+		c.Write(e)
+
+		other := newEnvelope(events.Envelope_LogMessage)
+		other.Tags = map[string]string{"source_id": "system"}
+		c.Write(other)
+		c.Write(newEnvelope(events.Envelope_LogMessage))
+
+		Expect(writer.envelopes).To(ConsistOf(e))
+	})
+
+	It("samples a percentage of envelopes", func() {
+		c := filter.NewChain(writer, nil, filter.Sample(25))
+
+		for i := 0; i < 10000; i++ {
+			c.Write(newEnvelope(events.Envelope_LogMessage))
+		}
+
+		Expect(len(writer.envelopes)).To(BeNumerically("~", 2500, 300))
+	})
+
+	It("transforms envelopes that pass the filters", func() {
+		c := filter.NewChain(
+			writer,
+			[]filter.Transform{
+				filter.SetOrigin("ouroboros-origin"),
+				filter.AddTags(map[string]string{"loop": "1", "source_id": "app-2"}),
+			},
+			filter.EventTypes(events.Envelope_LogMessage),
+		)
+
+		e := newEnvelope(events.Envelope_LogMessage)
+		e.Tags = map[string]string{"source_id": "app-1", "other": "tag"}
+		c.Write(e)
+		c.Write(newEnvelope(events.Envelope_LogMessage))
+		c.Write(newEnvelope(events.Envelope_ValueMetric))
+
+		Expect(writer.envelopes).To(HaveLen(2))
+		Expect(writer.envelopes[0].GetOrigin()).To(Equal("ouroboros-origin"))
+		Expect(writer.envelopes[0].GetTags()).To(Equal(map[string]string{
+			"source_id": "app-2",
+			"other":     "tag",
+			"loop":      "1",
+		}))
+		Expect(writer.envelopes[1].GetTags()).To(Equal(map[string]string{
+			"source_id": "app-2",
+			"loop":      "1",
+		}))
+	})
+
+	Describe("ParseEventTypes", func() {
+		It("parses event type names", func() {
+			types, err := filter.ParseEventTypes([]string{"LogMessage", "ContainerMetric"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(types).To(Equal([]events.Envelope_EventType{
+				events.Envelope_LogMessage,
+				events.Envelope_ContainerMetric,
+			}))
+		})
+
+		It("returns an error for unknown event types", func() {
+			_, err := filter.ParseEventTypes([]string{"Heartbeat"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+func newEnvelope(t events.Envelope_EventType) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("some-origin"),
+		Timestamp: proto.Int64(99),
+		EventType: t.Enum(),
+	}
+}
+
+type spyEnvelopeWriter struct {
+	envelopes []*events.Envelope
+}
+
+func newSpyEnvelopeWriter() *spyEnvelopeWriter {
+	return &spyEnvelopeWriter{}
+}
+
+func (s *spyEnvelopeWriter) Write(e *events.Envelope) {
+	s.envelopes = append(s.envelopes, e)
+}
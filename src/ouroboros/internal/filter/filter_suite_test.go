@@ -0,0 +1,17 @@
+package filter_test
+
+import (
+	"log"
+	"logging"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFilter(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	logging.SetOutput(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ouroboros - Filter Suite")
+}
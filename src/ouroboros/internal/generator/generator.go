@@ -0,0 +1,237 @@
+package generator
+
+import (
+	"conf"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"ouroboros/internal/ingress"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Origin is the origin of every generated envelope.
+const Origin = "ouroboros_generator"
+
+// maxBacklog is how far behind the rate the Generator catches up after a
+// slow write. Envelopes due longer ago are skipped rather than sent in one
+// burst.
+const maxBacklog = 100 * time.Millisecond
+
+// Generator is an ingress Consumer that produces synthetic envelopes rather
+// than reading them from Loggregator.
+type Generator struct {
+	rate           float64
+	mix            Mix
+	payloadSize    conf.IntRange
+	appIDs         []appID
+	tags           int
+	tagCardinality int
+	rand           *rand.Rand
+}
+
+type appID struct {
+	id   string
+	uuid *events.UUID
+}
+
+// New creates a Generator that writes rate envelopes per second of the
+// event types in the mix. LogMessage and Error payloads have a size in
+// payloadSize bytes. App envelopes use one of appCount app IDs, and every
+// envelope has tags generator tags with tagCardinality values each.
+func New(
+	rate float64,
+	mix Mix,
+	payloadSize conf.IntRange,
+	appCount int,
+	tags int,
+	tagCardinality int,
+) *Generator {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	ids := make([]appID, appCount)
+	for i := range ids {
+		ids[i] = newAppID(r)
+	}
+
+	return &Generator{
+		rate:           rate,
+		mix:            mix,
+		payloadSize:    payloadSize,
+		appIDs:         ids,
+		tags:           tags,
+		tagCardinality: tagCardinality,
+		rand:           r,
+	}
+}
+
+// Consume writes envelopes at the configured rate until the context is
+// done. If writes fall behind, at most maxBacklog worth of envelopes are
+// caught up on each tick.
+func (g *Generator) Consume(ctx context.Context, w ingress.EnvelopeWriter) error {
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+
+	start := time.Now()
+	var sent float64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-t.C:
+			due := g.rate * now.Sub(start).Seconds()
+			if oldest := due - g.rate*maxBacklog.Seconds(); sent < oldest {
+				sent = oldest
+			}
+			for ; sent < due; sent++ {
+				if ctx.Err() != nil {
+					return nil
+				}
+				w.Write(g.Envelope())
+			}
+		}
+	}
+}
+
+// Envelope generates a single envelope.
+func (g *Generator) Envelope() *events.Envelope {
+	t := g.mix.pick(g.rand)
+	e := &events.Envelope{
+		Origin:    proto.String(Origin),
+		EventType: t.Enum(),
+		Timestamp: proto.Int64(time.Now().UnixNano()),
+		Tags:      g.generateTags(),
+	}
+
+	switch t {
+	case events.Envelope_LogMessage:
+		e.LogMessage = g.logMessage()
+	case events.Envelope_ValueMetric:
+		e.ValueMetric = &events.ValueMetric{
+			Name:  proto.String(fmt.Sprintf("generated_value_%d", g.rand.Intn(10))),
+			Value: proto.Float64(g.rand.Float64() * 1000),
+			Unit:  proto.String("ms"),
+		}
+	case events.Envelope_CounterEvent:
+		delta := uint64(g.rand.Intn(100) + 1)
+		e.CounterEvent = &events.CounterEvent{
+			Name:  proto.String(fmt.Sprintf("generated_counter_%d", g.rand.Intn(10))),
+			Delta: proto.Uint64(delta),
+			Total: proto.Uint64(delta),
+		}
+	case events.Envelope_ContainerMetric:
+		e.ContainerMetric = g.containerMetric()
+	case events.Envelope_HttpStartStop:
+		e.HttpStartStop = g.httpStartStop()
+	case events.Envelope_Error:
+		e.Error = &events.Error{
+			Source:  proto.String(Origin),
+			Code:    proto.Int32(int32(g.rand.Intn(600))),
+			Message: proto.String(string(g.payload())),
+		}
+	}
+
+	return e
+}
+
+func (g *Generator) logMessage() *events.LogMessage {
+	msgType := events.LogMessage_OUT
+	if g.rand.Intn(2) == 0 {
+		msgType = events.LogMessage_ERR
+	}
+
+	return &events.LogMessage{
+		Message:        g.payload(),
+		MessageType:    msgType.Enum(),
+		Timestamp:      proto.Int64(time.Now().UnixNano()),
+		AppId:          proto.String(g.appID().id),
+		SourceType:     proto.String("APP/PROC/WEB"),
+		SourceInstance: proto.String(fmt.Sprint(g.rand.Intn(4))),
+	}
+}
+
+func (g *Generator) containerMetric() *events.ContainerMetric {
+	return &events.ContainerMetric{
+		ApplicationId:    proto.String(g.appID().id),
+		InstanceIndex:    proto.Int32(int32(g.rand.Intn(4))),
+		CpuPercentage:    proto.Float64(g.rand.Float64() * 100),
+		MemoryBytes:      proto.Uint64(uint64(g.rand.Int63n(1 << 30))),
+		DiskBytes:        proto.Uint64(uint64(g.rand.Int63n(1 << 30))),
+		MemoryBytesQuota: proto.Uint64(1 << 30),
+		DiskBytesQuota:   proto.Uint64(1 << 30),
+	}
+}
+
+func (g *Generator) httpStartStop() *events.HttpStartStop {
+	stop := time.Now()
+	start := stop.Add(-time.Duration(g.rand.Intn(1000)) * time.Millisecond)
+
+	return &events.HttpStartStop{
+		StartTimestamp: proto.Int64(start.UnixNano()),
+		StopTimestamp:  proto.Int64(stop.UnixNano()),
+		RequestId:      newAppID(g.rand).uuid,
+		PeerType:       events.PeerType_Server.Enum(),
+		Method:         events.Method_GET.Enum(),
+		Uri:            proto.String(fmt.Sprintf("https://generated.example.com/%d", g.rand.Intn(100))),
+		RemoteAddress:  proto.String("10.0.0.1:12345"),
+		UserAgent:      proto.String(Origin),
+		StatusCode:     proto.Int32(200),
+		ContentLength:  proto.Int64(int64(g.rand.Intn(10000))),
+		ApplicationId:  g.appID().uuid,
+		InstanceIndex:  proto.Int32(int32(g.rand.Intn(4))),
+	}
+}
+
+func (g *Generator) appID() appID {
+	return g.appIDs[g.rand.Intn(len(g.appIDs))]
+}
+
+// payload returns printable bytes with a size in the payload size range.
+func (g *Generator) payload() []byte {
+	size := g.payloadSize.Min
+	if g.payloadSize.Max > g.payloadSize.Min {
+		size += g.rand.Intn(g.payloadSize.Max - g.payloadSize.Min + 1)
+	}
+
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789 "
+	p := make([]byte, size)
+	for i := range p {
+		p[i] = letters[g.rand.Intn(len(letters))]
+	}
+
+	return p
+}
+
+func (g *Generator) generateTags() map[string]string {
+	if g.tags == 0 {
+		return nil
+	}
+
+	tags := make(map[string]string, g.tags)
+	for i := 0; i < g.tags; i++ {
+		tags[fmt.Sprintf("generator_tag_%d", i)] = fmt.Sprintf("value_%d", g.rand.Intn(g.tagCardinality))
+	}
+
+	return tags
+}
+
+func newAppID(r *rand.Rand) appID {
+	low, high := r.Uint64(), r.Uint64()
+
+	lowBytes := make([]byte, 8)
+	highBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(lowBytes, low)
+	binary.LittleEndian.PutUint64(highBytes, high)
+
+	return appID{
+		id: fmt.Sprintf("%x-%x-%x-%x-%x",
+			lowBytes[:4], lowBytes[4:6], lowBytes[6:], highBytes[:2], highBytes[2:]),
+		uuid: &events.UUID{
+			Low:  proto.Uint64(low),
+			High: proto.Uint64(high),
+		},
+	}
+}
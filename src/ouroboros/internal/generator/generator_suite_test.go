@@ -0,0 +1,17 @@
+package generator_test
+
+import (
+	"log"
+	"logging"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestGenerator(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	logging.SetOutput(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ouroboros - Generator Suite")
+}
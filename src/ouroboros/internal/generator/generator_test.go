@@ -0,0 +1,150 @@
+package generator_test
+
+import (
+	"conf"
+	"context"
+	"ouroboros/internal/converter"
+	"ouroboros/internal/generator"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Generator", func() {
+	It("only generates event types in the mix", func() {
+		g := generator.New(
+			100,
+			generator.Mix{
+				{EventType: events.Envelope_LogMessage, Weight: 1},
+				{EventType: events.Envelope_Error, Weight: 1},
+				{EventType: events.Envelope_ValueMetric, Weight: 0},
+			},
+			conf.IntRange{Min: 10, Max: 10},
+			1,
+			0,
+			1,
+		)
+
+		types := make(map[events.Envelope_EventType]bool)
+		for i := 0; i < 100; i++ {
+			e := g.Envelope()
+			types[e.GetEventType()] = true
+			Expect(e.GetOrigin()).To(Equal("ouroboros_generator"))
+		}
+
+		Expect(types).To(Equal(map[events.Envelope_EventType]bool{
+			events.Envelope_LogMessage: true,
+			events.Envelope_Error:      true,
+		}))
+	})
+
+	It("varies payload sizes within the range", func() {
+		g := generator.New(
+			100,
+			generator.Mix{{EventType: events.Envelope_LogMessage, Weight: 1}},
+			conf.IntRange{Min: 5, Max: 20},
+			1,
+			0,
+			1,
+		)
+
+		for i := 0; i < 100; i++ {
+			size := len(g.Envelope().GetLogMessage().GetMessage())
+			Expect(size).To(BeNumerically(">=", 5))
+			Expect(size).To(BeNumerically("<=", 20))
+		}
+	})
+
+	It("bounds the app IDs and tag values", func() {
+		g := generator.New(
+			100,
+			generator.Mix{{EventType: events.Envelope_ContainerMetric, Weight: 1}},
+			conf.IntRange{Min: 1, Max: 1},
+			3,
+			2,
+			4,
+		)
+
+		appIDs := make(map[string]bool)
+		tagValues := make(map[string]bool)
+		for i := 0; i < 500; i++ {
+			e := g.Envelope()
+			appIDs[e.GetContainerMetric().GetApplicationId()] = true
+			Expect(e.GetTags()).To(HaveLen(2))
+			tagValues[e.GetTags()["generator_tag_0"]] = true
+		}
+
+		Expect(appIDs).To(HaveLen(3))
+		Expect(tagValues).To(HaveLen(4))
+	})
+
+	It("generates envelopes the converter can convert", func() {
+		g := generator.New(100, generator.DefaultMix, conf.IntRange{Min: 1, Max: 100}, 10, 1, 10)
+
+		for i := 0; i < 200; i++ {
+			e := g.Envelope()
+			v2e := converter.ToV2(e, false)
+			Expect(v2e.GetSourceId()).ToNot(BeEmpty())
+		}
+	})
+
+	It("writes envelopes at the rate until the context is done", func() {
+		g := generator.New(1000, generator.DefaultMix, conf.IntRange{Min: 1, Max: 10}, 1, 0, 1)
+		writer := &countingWriter{}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		Expect(g.Consume(ctx, writer)).To(Succeed())
+
+		Expect(writer.Count()).To(BeNumerically("~", 200, 50))
+	})
+
+	It("stops catching up once the context is done", func() {
+		g := generator.New(100000, generator.DefaultMix, conf.IntRange{Min: 1, Max: 10}, 1, 0, 1)
+		writer := &countingWriter{block: 200 * time.Millisecond}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		Expect(g.Consume(ctx, writer)).To(Succeed())
+
+		Expect(writer.Count()).To(Equal(1))
+	})
+
+	It("skips envelopes it is too far behind on", func() {
+		g := generator.New(1000, generator.DefaultMix, conf.IntRange{Min: 1, Max: 10}, 1, 0, 1)
+		writer := &countingWriter{block: 500 * time.Millisecond}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+		defer cancel()
+		Expect(g.Consume(ctx, writer)).To(Succeed())
+
+		Expect(writer.Count()).To(BeNumerically("<", 400))
+	})
+})
+
+// countingWriter counts envelopes. If block is set, the first write takes
+// that long.
+type countingWriter struct {
+	mu    sync.Mutex
+	count int
+	block time.Duration
+}
+
+func (w *countingWriter) Write(*events.Envelope) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.count == 0 {
+		time.Sleep(w.block)
+	}
+	w.count++
+}
+
+func (w *countingWriter) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// Weight is the relative share of generated envelopes of an event type.
+type Weight struct {
+	EventType events.Envelope_EventType
+	Weight    int
+}
+
+// Mix is the event types the generator produces and their relative
+// weights.
+type Mix []Weight
+
+// DefaultMix produces every supported event type equally often.
+var DefaultMix = Mix{
+	{EventType: events.Envelope_LogMessage, Weight: 1},
+	{EventType: events.Envelope_ValueMetric, Weight: 1},
+	{EventType: events.Envelope_CounterEvent, Weight: 1},
+	{EventType: events.Envelope_ContainerMetric, Weight: 1},
+	{EventType: events.Envelope_HttpStartStop, Weight: 1},
+	{EventType: events.Envelope_Error, Weight: 1},
+}
+
+// UnmarshalEnv parses a mix of the format {event type}:{weight},... e.g.
+// "LogMessage:8,ValueMetric:1,CounterEvent:1" produces 80% LogMessages.
+func (m *Mix) UnmarshalEnv(v string) error {
+	var mix Mix
+	for _, w := range strings.Split(v, ",") {
+		values := strings.Split(strings.TrimSpace(w), ":")
+		if len(values) != 2 {
+			return fmt.Errorf("Expected Mix to be of format {event type}:{weight}")
+		}
+
+		t, ok := events.Envelope_EventType_value[values[0]]
+		if !ok || !supported(events.Envelope_EventType(t)) {
+			return fmt.Errorf("Unsupported Mix event type: %s", values[0])
+		}
+
+		weight, err := strconv.Atoi(values[1])
+		if err != nil || weight < 0 {
+			return fmt.Errorf("Error parsing Mix weight: %s", values[1])
+		}
+
+		mix = append(mix, Weight{
+			EventType: events.Envelope_EventType(t),
+			Weight:    weight,
+		})
+	}
+
+	if mix.total() == 0 {
+		return fmt.Errorf("Expected Mix to have a weight above 0")
+	}
+
+	*m = mix
+	return nil
+}
+
+func (m Mix) pick(r *rand.Rand) events.Envelope_EventType {
+	n := r.Intn(m.total())
+	for _, w := range m {
+		if n < w.Weight {
+			return w.EventType
+		}
+		n -= w.Weight
+	}
+
+	return m[len(m)-1].EventType
+}
+
+func (m Mix) total() int {
+	var total int
+	for _, w := range m {
+		total += w.Weight
+	}
+
+	return total
+}
+
+func supported(t events.Envelope_EventType) bool {
+	for _, w := range DefaultMix {
+		if w.EventType == t {
+			return true
+		}
+	}
+
+	return false
+}
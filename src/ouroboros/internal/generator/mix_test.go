@@ -0,0 +1,34 @@
+package generator_test
+
+import (
+	"ouroboros/internal/generator"
+
+	"github.com/cloudfoundry/sonde-go/events"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mix", func() {
+	It("parses event types and weights", func() {
+		var m generator.Mix
+		Expect(m.UnmarshalEnv("LogMessage:8, ValueMetric:2")).To(Succeed())
+
+		Expect(m).To(Equal(generator.Mix{
+			{EventType: events.Envelope_LogMessage, Weight: 8},
+			{EventType: events.Envelope_ValueMetric, Weight: 2},
+		}))
+	})
+
+	It("rejects unsupported event types", func() {
+		var m generator.Mix
+		Expect(m.UnmarshalEnv("Bogus:1")).ToNot(Succeed())
+	})
+
+	It("rejects invalid weights", func() {
+		var m generator.Mix
+		Expect(m.UnmarshalEnv("LogMessage")).ToNot(Succeed())
+		Expect(m.UnmarshalEnv("LogMessage:-1")).ToNot(Succeed())
+		Expect(m.UnmarshalEnv("LogMessage:0")).ToNot(Succeed())
+	})
+})
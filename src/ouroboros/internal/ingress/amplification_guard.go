@@ -0,0 +1,63 @@
+package ingress
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// HopsTag is the envelope tag ouroboros uses to record how many times an
+// envelope has been written back into Loggregator.
+const HopsTag = "ouroboros_hops"
+
+// AmplificationGuard bounds how many times ouroboros re-emits the same
+// envelope. Every envelope written through the guard is tagged with its hop
+// count. Envelopes that come back around the loop having already been
+// re-emitted maxGenerations times are dropped.
+type AmplificationGuard struct {
+	maxGenerations int
+	writer         EnvelopeWriter
+	dropped        uint64
+}
+
+func NewAmplificationGuard(maxGenerations int, w EnvelopeWriter) *AmplificationGuard {
+	return &AmplificationGuard{
+		maxGenerations: maxGenerations,
+		writer:         w,
+	}
+}
+
+func (g *AmplificationGuard) Write(e *events.Envelope) {
+	hops := Hops(e)
+	if hops >= g.maxGenerations {
+		dropped := atomic.AddUint64(&g.dropped, 1)
+		if dropped%1000 == 0 {
+			logger.Infof("Dropped %d re-emitted envelopes", dropped)
+		}
+		return
+	}
+
+	if e.Tags == nil {
+		e.Tags = make(map[string]string)
+	}
+	e.Tags[HopsTag] = strconv.Itoa(hops + 1)
+
+	g.writer.Write(e)
+}
+
+// Dropped returns the number of envelopes dropped by the guard.
+func (g *AmplificationGuard) Dropped() uint64 {
+	return atomic.LoadUint64(&g.dropped)
+}
+
+// Hops returns the number of times ouroboros has already written the
+// envelope. Envelopes without a valid hops tag have not been re-emitted.
+func Hops(e *events.Envelope) int {
+	hops, err := strconv.Atoi(e.GetTags()[HopsTag])
+	if err != nil || hops < 0 {
+		return 0
+	}
+
+	return hops
+}
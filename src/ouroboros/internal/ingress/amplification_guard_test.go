@@ -0,0 +1,84 @@
+package ingress_test
+
+import (
+	"ouroboros/internal/ingress"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AmplificationGuard", func() {
+	var (
+		writer *spyEnvelopeWriter
+		guard  *ingress.AmplificationGuard
+	)
+
+	BeforeEach(func() {
+		writer = newSpyEnvelopeWriter()
+		guard = ingress.NewAmplificationGuard(2, writer)
+	})
+
+	It("tags envelopes that have not been re-emitted with a hop count of 1", func() {
+		guard.Write(envelopeWithTags(nil))
+
+		var e *events.Envelope
+		Expect(writer.envelope).To(Receive(&e))
+		Expect(e.GetTags()).To(HaveKeyWithValue("ouroboros_hops", "1"))
+	})
+
+	It("increments the hop count of re-emitted envelopes", func() {
+		guard.Write(envelopeWithTags(map[string]string{
+			"ouroboros_hops": "1",
+			"other":          "tag",
+		}))
+
+		var e *events.Envelope
+		Expect(writer.envelope).To(Receive(&e))
+		Expect(e.GetTags()).To(HaveKeyWithValue("ouroboros_hops", "2"))
+		Expect(e.GetTags()).To(HaveKeyWithValue("other", "tag"))
+	})
+
+	It("drops envelopes that have reached the maximum generations", func() {
+		guard.Write(envelopeWithTags(map[string]string{"ouroboros_hops": "2"}))
+		guard.Write(envelopeWithTags(map[string]string{"ouroboros_hops": "3"}))
+
+		Expect(writer.envelope).ToNot(Receive())
+		Expect(guard.Dropped()).To(Equal(uint64(2)))
+	})
+
+	It("treats an invalid hop count as not re-emitted", func() {
+		guard.Write(envelopeWithTags(map[string]string{"ouroboros_hops": "garbage"}))
+
+		var e *events.Envelope
+		Expect(writer.envelope).To(Receive(&e))
+		Expect(e.GetTags()).To(HaveKeyWithValue("ouroboros_hops", "1"))
+	})
+
+	Context("with a single generation", func() {
+		BeforeEach(func() {
+			guard = ingress.NewAmplificationGuard(1, writer)
+		})
+
+		It("drops every envelope ouroboros has already written", func() {
+			guard.Write(envelopeWithTags(nil))
+
+			var e *events.Envelope
+			Expect(writer.envelope).To(Receive(&e))
+
+			guard.Write(e)
+			Expect(writer.envelope).ToNot(Receive())
+		})
+	})
+})
+
+func envelopeWithTags(tags map[string]string) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("some-origin"),
+		Timestamp: proto.Int64(99),
+		EventType: events.Envelope_LogMessage.Enum(),
+		Tags:      tags,
+	}
+}
@@ -0,0 +1,68 @@
+package ingress
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+)
+
+// CounterEmitter writes ouroboros CounterEvents and ValueMetrics, tagged
+// with the details of the ouroboros instance, to an EnvelopeWriter.
+type CounterEmitter struct {
+	deploymentName string
+	jobName        string
+	instanceIndex  string
+	instanceIP     string
+	writer         EnvelopeWriter
+}
+
+func NewCounterEmitter(deployment, job, idx, ip string, w EnvelopeWriter) *CounterEmitter {
+	return &CounterEmitter{
+		deploymentName: deployment,
+		jobName:        job,
+		instanceIndex:  idx,
+		instanceIP:     ip,
+		writer:         w,
+	}
+}
+
+func (c *CounterEmitter) EmitCounter(name string, delta uint64) {
+	c.EmitTaggedCounter(name, delta, nil)
+}
+
+// EmitTaggedCounter emits a counter with the given envelope tags.
+func (c *CounterEmitter) EmitTaggedCounter(name string, delta uint64, tags map[string]string) {
+	env := c.envelope(events.Envelope_CounterEvent)
+	env.Tags = tags
+	env.CounterEvent = &events.CounterEvent{
+		Name:  proto.String(name),
+		Delta: proto.Uint64(delta),
+	}
+
+	c.writer.Write(env)
+}
+
+// EmitValue emits a ValueMetric.
+func (c *CounterEmitter) EmitValue(name string, value float64, unit string) {
+	env := c.envelope(events.Envelope_ValueMetric)
+	env.ValueMetric = &events.ValueMetric{
+		Name:  proto.String(name),
+		Value: proto.Float64(value),
+		Unit:  proto.String(unit),
+	}
+
+	c.writer.Write(env)
+}
+
+func (c *CounterEmitter) envelope(t events.Envelope_EventType) *events.Envelope {
+	return &events.Envelope{
+		Origin:     proto.String("ouroboros"),
+		Timestamp:  proto.Int64(time.Now().UnixNano()),
+		Deployment: proto.String(c.deploymentName),
+		Job:        proto.String(c.jobName),
+		Index:      proto.String(c.instanceIndex),
+		Ip:         proto.String(c.instanceIP),
+		EventType:  t.Enum(),
+	}
+}
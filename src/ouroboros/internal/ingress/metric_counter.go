@@ -1,59 +1,194 @@
 package ingress
 
 import (
-	"log"
+	"sync"
 	"time"
 
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"github.com/cloudfoundry/sonde-go/events"
-	"github.com/gogo/protobuf/proto"
 )
 
+// MetricCounter counts the envelopes written through it and reports them
+// as CounterEvents. It emits an ingress counter with the total, and an
+// ingress_breakdown counter per event type and origin; the origin tag is
+// left out for envelopes without one. Counters are
+// reported every reportCount envelopes and, if a flush interval is set,
+// at least once per interval until the MetricCounter is stopped.
 type MetricCounter struct {
-	deploymentName string
-	jobName        string
-	instanceIndex  string
-	instanceIP     string
-	reportCount    uint64
-	counter        uint64
-	writer         EnvelopeWriter
+	mu          sync.Mutex
+	reportCount uint64
+	pending     uint64
+	breakdown   map[breakdownKey]uint64
+	writer      EnvelopeWriter
+	emitter     *CounterEmitter
+	done        chan struct{}
+	stopped     chan struct{}
 }
 
-func NewMetricCounter(deployment, job, idx, ip string, reportCount uint64, w EnvelopeWriter) *MetricCounter {
-	return &MetricCounter{
-		deploymentName: deployment,
-		jobName:        job,
-		instanceIndex:  idx,
-		instanceIP:     ip,
-		reportCount:    reportCount,
-		writer:         w,
+type breakdownKey struct {
+	eventType string
+	origin    string
+}
+
+func (k breakdownKey) tags() map[string]string {
+	t := map[string]string{"event_type": k.eventType}
+	if k.origin != "" {
+		t["origin"] = k.origin
 	}
+
+	return t
+}
+
+func NewMetricCounter(
+	deployment, job, idx, ip string,
+	reportCount uint64,
+	flushInterval time.Duration,
+	w EnvelopeWriter,
+) *MetricCounter {
+	m := &MetricCounter{
+		reportCount: reportCount,
+		breakdown:   make(map[breakdownKey]uint64),
+		writer:      w,
+		emitter:     NewCounterEmitter(deployment, job, idx, ip, w),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	if flushInterval > 0 {
+		go m.flushEvery(flushInterval)
+	} else {
+		close(m.stopped)
+	}
+
+	return m
 }
 
 func (m *MetricCounter) Write(e *events.Envelope) {
-	m.counter++
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	m.count(e.GetEventType().String(), e.GetOrigin())
 	m.writer.Write(e)
+	m.flushIfDue()
+}
+
+// Flush emits counters for the envelopes written since the last report. It
+// is called on shutdown so the ingress count is accurate.
+func (m *MetricCounter) Flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.flush()
+}
+
+// IncrementReconnects emits a reconnects counter each time the firehose
+// connection is re-established.
+func (m *MetricCounter) IncrementReconnects() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emitter.EmitCounter("reconnects", 1)
+}
+
+// EmitValue emits a ValueMetric. Writes are serialized with envelopes
+// written through the MetricCounter, so it is safe to call from another
+// goroutine.
+func (m *MetricCounter) EmitValue(name string, value float64, unit string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emitter.EmitValue(name, value, unit)
+}
+
+// Stop stops flushing on the interval and waits for any flush in progress
+// to finish. It must be called before the writer is closed.
+func (m *MetricCounter) Stop() {
+	close(m.done)
+	<-m.stopped
+}
 
-	if m.counter%m.reportCount == 0 {
-		m.emitIngressCounter(m.reportCount)
-		log.Printf("Ingressed %d envelopes", m.reportCount)
+func (m *MetricCounter) flushEvery(d time.Duration) {
+	defer close(m.stopped)
+
+	t := time.NewTicker(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			m.Flush()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *MetricCounter) count(eventType, origin string) {
+	m.pending++
+	m.breakdown[breakdownKey{
+		eventType: eventType,
+		origin:    origin,
+	}]++
+}
+
+func (m *MetricCounter) flushIfDue() {
+	if m.pending >= m.reportCount {
+		m.flush()
+	}
+}
+
+func (m *MetricCounter) flush() {
+	if m.pending == 0 {
+		return
 	}
+
+	m.emitter.EmitCounter("ingress", m.pending)
+	for k, n := range m.breakdown {
+		m.emitter.EmitTaggedCounter("ingress_breakdown", n, k.tags())
+	}
+	logger.Infof("Ingressed %d envelopes", m.pending)
+
+	m.pending = 0
+	m.breakdown = make(map[breakdownKey]uint64)
+}
+
+// V2MetricCounter counts V2 envelopes with a MetricCounter and writes them
+// unchanged to a V2Writer. V2 envelopes are broken down by the equivalent
+// V1 event type only. Their source ID is usually an app GUID, so breaking
+// them down by it would emit a counter per app.
+type V2MetricCounter struct {
+	counter *MetricCounter
+	writer  V2Writer
+}
+
+func NewV2MetricCounter(c *MetricCounter, w V2Writer) *V2MetricCounter {
+	return &V2MetricCounter{counter: c, writer: w}
+}
+
+func (c *V2MetricCounter) WriteV2(e *loggregator_v2.Envelope) {
+	m := c.counter
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.count(V2EventType(e), "")
+	c.writer.WriteV2(e)
+	m.flushIfDue()
 }
 
-func (m *MetricCounter) emitIngressCounter(delta uint64) {
-	env := &events.Envelope{
-		Origin:     proto.String("ouroboros"),
-		Timestamp:  proto.Int64(time.Now().UnixNano()),
-		Deployment: proto.String(m.deploymentName),
-		Job:        proto.String(m.jobName),
-		Index:      proto.String(m.instanceIndex),
-		Ip:         proto.String(m.instanceIP),
-		EventType:  events.Envelope_CounterEvent.Enum(),
-		CounterEvent: &events.CounterEvent{
-			Name:  proto.String("ingress"),
-			Delta: proto.Uint64(delta),
-		},
+// V2EventType names the V1 event type a V2 envelope corresponds to.
+func V2EventType(e *loggregator_v2.Envelope) string {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return events.Envelope_LogMessage.String()
+	case *loggregator_v2.Envelope_Counter:
+		return events.Envelope_CounterEvent.String()
+	case *loggregator_v2.Envelope_Gauge:
+		return events.Envelope_ValueMetric.String()
+	case *loggregator_v2.Envelope_Timer:
+		return events.Envelope_HttpStartStop.String()
+	case *loggregator_v2.Envelope_Event:
+		return "Event"
 	}
 
-	m.writer.Write(env)
+	return "Unknown"
 }
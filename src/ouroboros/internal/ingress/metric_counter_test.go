@@ -1,8 +1,11 @@
 package ingress_test
 
 import (
+	"fmt"
 	"ouroboros/internal/ingress"
+	"time"
 
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"github.com/cloudfoundry/sonde-go/events"
 	"github.com/gogo/protobuf/proto"
 	. "github.com/onsi/ginkgo"
@@ -12,6 +15,8 @@ import (
 var _ = Describe("MetricCounter", func() {
 	var (
 		envelope *events.Envelope
+		writer   *spyEnvelopeWriter
+		mc       *ingress.MetricCounter
 	)
 
 	BeforeEach(func() {
@@ -20,25 +25,25 @@ var _ = Describe("MetricCounter", func() {
 			Timestamp: proto.Int64(99),
 			EventType: events.Envelope_LogMessage.Enum(),
 		}
-	})
-
-	It("emits a counter envelope for a given number of writes", func() {
-		writer := newSpyEnvelopeWriter()
-		mc := ingress.NewMetricCounter(
+		writer = newSpyEnvelopeWriter()
+		mc = ingress.NewMetricCounter(
 			"deployment-name",
 			"job-name",
 			"instance-index",
 			"instance-ip",
 			10,
+			0,
 			writer,
 		)
+	})
 
+	It("emits a counter envelope for a given number of writes", func() {
 		for i := 0; i < 10; i++ {
 			mc.Write(envelope)
 		}
 
 		s := toSlice(writer.envelope)
-		Expect(s).To(HaveLen(11))
+		Expect(s).To(HaveLen(12))
 		Expect(s[10].GetTimestamp()).ToNot(Equal(int64(0)))
 		Expect(s[10].GetDeployment()).To(Equal("deployment-name"))
 		Expect(s[10].GetJob()).To(Equal("job-name"))
@@ -47,8 +52,150 @@ var _ = Describe("MetricCounter", func() {
 		Expect(s[10].GetCounterEvent().GetDelta()).To(Equal(uint64(10)))
 		Expect(s[10].GetCounterEvent().GetName()).To(Equal("ingress"))
 	})
+
+	It("breaks the count down by event type and origin", func() {
+		for i := 0; i < 6; i++ {
+			mc.Write(envelope)
+		}
+		for i := 0; i < 4; i++ {
+			mc.Write(&events.Envelope{
+				Origin:    proto.String("other-origin"),
+				Timestamp: proto.Int64(99),
+				EventType: events.Envelope_ValueMetric.Enum(),
+			})
+		}
+
+		breakdown := make(map[string]uint64)
+		for _, e := range toSlice(writer.envelope)[11:] {
+			Expect(e.GetCounterEvent().GetName()).To(Equal("ingress_breakdown"))
+			Expect(e.GetDeployment()).To(Equal("deployment-name"))
+			key := e.GetTags()["event_type"] + "/" + e.GetTags()["origin"]
+			breakdown[key] = e.GetCounterEvent().GetDelta()
+		}
+		Expect(breakdown).To(Equal(map[string]uint64{
+			"LogMessage/some-origin":   6,
+			"ValueMetric/other-origin": 4,
+		}))
+	})
+
+	It("emits the remaining ingress count when flushed", func() {
+		for i := 0; i < 13; i++ {
+			mc.Write(envelope)
+		}
+		mc.Flush()
+		mc.Flush()
+
+		s := toSlice(writer.envelope)
+		Expect(s).To(HaveLen(17))
+		Expect(s[15].GetCounterEvent().GetName()).To(Equal("ingress"))
+		Expect(s[15].GetCounterEvent().GetDelta()).To(Equal(uint64(3)))
+		Expect(s[16].GetCounterEvent().GetName()).To(Equal("ingress_breakdown"))
+		Expect(s[16].GetCounterEvent().GetDelta()).To(Equal(uint64(3)))
+	})
+
+	It("flushes on the interval", func() {
+		mc = ingress.NewMetricCounter(
+			"deployment-name",
+			"job-name",
+			"instance-index",
+			"instance-ip",
+			1000,
+			10*time.Millisecond,
+			writer,
+		)
+		mc.Write(envelope)
+
+		Eventually(func() []string {
+			var names []string
+			for _, e := range toSlice(writer.envelope) {
+				names = append(names, e.GetCounterEvent().GetName())
+			}
+			return names
+		}).Should(ContainElement("ingress"))
+	})
+
+	It("stops flushing on the interval once stopped", func() {
+		mc = ingress.NewMetricCounter(
+			"deployment-name",
+			"job-name",
+			"instance-index",
+			"instance-ip",
+			1000,
+			10*time.Millisecond,
+			writer,
+		)
+		mc.Stop()
+		mc.Write(envelope)
+		Expect(writer.envelope).To(Receive(Equal(envelope)))
+
+		Consistently(writer.envelope, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("emits a counter envelope for every reconnect", func() {
+		mc.IncrementReconnects()
+
+		s := toSlice(writer.envelope)
+		Expect(s).To(HaveLen(1))
+		Expect(s[0].GetOrigin()).To(Equal("ouroboros"))
+		Expect(s[0].GetDeployment()).To(Equal("deployment-name"))
+		Expect(s[0].GetCounterEvent().GetDelta()).To(Equal(uint64(1)))
+		Expect(s[0].GetCounterEvent().GetName()).To(Equal("reconnects"))
+	})
+
+	It("counts V2 envelopes and writes them unchanged", func() {
+		v2Writer := newSpyV2Writer()
+		c := ingress.NewV2MetricCounter(mc, v2Writer)
+		v2e := &loggregator_v2.Envelope{
+			SourceId: "some-source",
+			Message:  &loggregator_v2.Envelope_Gauge{Gauge: &loggregator_v2.Gauge{}},
+		}
+		for i := 0; i < 10; i++ {
+			c.WriteV2(v2e)
+		}
+
+		Expect(v2Writer.envelope).To(HaveLen(10))
+		Expect(<-v2Writer.envelope).To(BeIdenticalTo(v2e))
+
+		s := toSlice(writer.envelope)
+		Expect(s).To(HaveLen(2))
+		Expect(s[0].GetCounterEvent().GetName()).To(Equal("ingress"))
+		Expect(s[0].GetCounterEvent().GetDelta()).To(Equal(uint64(10)))
+		Expect(s[1].GetTags()).To(HaveKeyWithValue("event_type", "ValueMetric"))
+		Expect(s[1].GetTags()).ToNot(HaveKey("origin"))
+	})
+
+	It("does not break V2 envelopes down by source ID", func() {
+		mc = ingress.NewMetricCounter("", "", "", "", 1000, 0, writer)
+		c := ingress.NewV2MetricCounter(mc, newSpyV2Writer())
+		for i := 0; i < 1000; i++ {
+			c.WriteV2(&loggregator_v2.Envelope{
+				SourceId: fmt.Sprintf("source-%d", i),
+				Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+			})
+		}
+
+		s := toSlice(writer.envelope)
+		Expect(s).To(HaveLen(2))
+		Expect(s[1].GetCounterEvent().GetName()).To(Equal("ingress_breakdown"))
+		Expect(s[1].GetCounterEvent().GetDelta()).To(Equal(uint64(1000)))
+		Expect(s[1].GetTags()).To(Equal(map[string]string{"event_type": "LogMessage"}))
+	})
 })
 
+type spyV2Writer struct {
+	envelope chan *loggregator_v2.Envelope
+}
+
+func newSpyV2Writer() *spyV2Writer {
+	return &spyV2Writer{
+		envelope: make(chan *loggregator_v2.Envelope, 1000),
+	}
+}
+
+func (s *spyV2Writer) WriteV2(e *loggregator_v2.Envelope) {
+	s.envelope <- e
+}
+
 func toSlice(c <-chan *events.Envelope) (results []*events.Envelope) {
 	for {
 		select {
@@ -0,0 +1,153 @@
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"ouroboros/internal/converter"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	"google.golang.org/grpc"
+)
+
+// V2Writer accepts V2 envelopes as they are read from the Reverse Log
+// Proxy.
+type V2Writer interface {
+	WriteV2(e *loggregator_v2.Envelope)
+}
+
+// RLPConsumer is a Consumer that reads V2 envelopes from the Reverse Log
+// Proxy. If it has a V2Writer envelopes are written to it unchanged and the
+// EnvelopeWriter passed to Consume is not used. Otherwise envelopes are
+// converted to V1 so they go through the same filters and counters as
+// firehose envelopes.
+type RLPConsumer struct {
+	addr      string
+	shardID   string
+	selectors []*loggregator_v2.Selector
+	batched   bool
+	v2Writer  V2Writer
+	dialOpts  []grpc.DialOption
+}
+
+// NewRLPConsumer creates an RLPConsumer. When batched is true envelopes are
+// read with BatchedReceiver rather than Receiver. The V2Writer may be nil.
+func NewRLPConsumer(
+	addr string,
+	shardID string,
+	selectors []*loggregator_v2.Selector,
+	batched bool,
+	v2Writer V2Writer,
+	dialOpts ...grpc.DialOption,
+) *RLPConsumer {
+	return &RLPConsumer{
+		addr:      addr,
+		shardID:   shardID,
+		selectors: selectors,
+		batched:   batched,
+		v2Writer:  v2Writer,
+		dialOpts:  dialOpts,
+	}
+}
+
+// Consume opens a stream to the RLP and writes every envelope to the
+// EnvelopeWriter until the stream fails or the context is done.
+func (c *RLPConsumer) Consume(ctx context.Context, w EnvelopeWriter) error {
+	conn, err := grpc.Dial(c.addr, c.dialOpts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := loggregator_v2.NewEgressClient(conn)
+	if c.batched {
+		return c.consumeBatches(ctx, client, w)
+	}
+
+	r, err := client.Receiver(ctx, &loggregator_v2.EgressRequest{
+		ShardId:   c.shardID,
+		Selectors: c.selectors,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		e, err := r.Recv()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.write(e, w)
+	}
+}
+
+func (c *RLPConsumer) consumeBatches(
+	ctx context.Context,
+	client loggregator_v2.EgressClient,
+	w EnvelopeWriter,
+) error {
+	r, err := client.BatchedReceiver(ctx, &loggregator_v2.EgressBatchRequest{
+		ShardId:   c.shardID,
+		Selectors: c.selectors,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		batch, err := r.Recv()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, e := range batch.GetBatch() {
+			c.write(e, w)
+		}
+	}
+}
+
+func (c *RLPConsumer) write(e *loggregator_v2.Envelope, w EnvelopeWriter) {
+	if c.v2Writer != nil {
+		c.v2Writer.WriteV2(e)
+		return
+	}
+
+	// Event envelopes have no V1 equivalent and are dropped here.
+	for _, v1e := range converter.ToV1(e) {
+		w.Write(v1e)
+	}
+}
+
+// ParseSelectors creates a selector for each envelope type, e.g. "log" or
+// "gauge", limited to the source ID if one is given.
+func ParseSelectors(types []string, sourceID string) ([]*loggregator_v2.Selector, error) {
+	var selectors []*loggregator_v2.Selector
+	for _, t := range types {
+		s := &loggregator_v2.Selector{SourceId: sourceID}
+
+		switch t {
+		case "log":
+			s.Message = &loggregator_v2.Selector_Log{Log: &loggregator_v2.LogSelector{}}
+		case "counter":
+			s.Message = &loggregator_v2.Selector_Counter{Counter: &loggregator_v2.CounterSelector{}}
+		case "gauge":
+			s.Message = &loggregator_v2.Selector_Gauge{Gauge: &loggregator_v2.GaugeSelector{}}
+		case "timer":
+			s.Message = &loggregator_v2.Selector_Timer{Timer: &loggregator_v2.TimerSelector{}}
+		case "event":
+			s.Message = &loggregator_v2.Selector_Event{Event: &loggregator_v2.EventSelector{}}
+		default:
+			return nil, fmt.Errorf("unknown selector type: %s", t)
+		}
+
+		selectors = append(selectors, s)
+	}
+
+	return selectors, nil
+}
@@ -0,0 +1,175 @@
+package ingress_test
+
+import (
+	"context"
+	"net"
+	"ouroboros/internal/ingress"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RLPConsumer", func() {
+	var (
+		rlp      *fakeRLP
+		addr     string
+		server   *grpc.Server
+		writer   *spyEnvelopeWriter
+		selector []*loggregator_v2.Selector
+	)
+
+	BeforeEach(func() {
+		rlp = newFakeRLP()
+		addr, server = startFakeRLP(rlp)
+		writer = newSpyEnvelopeWriter()
+
+		var err error
+		selector, err = ingress.ParseSelectors([]string{"log"}, "some-source")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("converts envelopes from the receiver to V1", func() {
+		c := ingress.NewRLPConsumer(addr, "shard", selector, false, nil, grpc.WithInsecure())
+		errs := make(chan error, 1)
+		go func() { errs <- c.Consume(context.Background(), writer) }()
+
+		var req *loggregator_v2.EgressRequest
+		Eventually(rlp.requests).Should(Receive(&req))
+		Expect(req.GetShardId()).To(Equal("shard"))
+		Expect(req.GetSelectors()).To(Equal(selector))
+
+		var e *events.Envelope
+		Eventually(writer.envelope).Should(Receive(&e))
+		Expect(e.GetEventType()).To(Equal(events.Envelope_LogMessage))
+		Expect(string(e.GetLogMessage().GetMessage())).To(Equal("hello"))
+
+		Eventually(errs).Should(Receive(HaveOccurred()))
+	})
+
+	It("converts envelopes from the batched receiver to V1", func() {
+		c := ingress.NewRLPConsumer(addr, "shard", selector, true, nil, grpc.WithInsecure())
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() { errs <- c.Consume(ctx, writer) }()
+
+		var req *loggregator_v2.EgressBatchRequest
+		Eventually(rlp.batchRequests).Should(Receive(&req))
+		Expect(req.GetShardId()).To(Equal("shard"))
+
+		Eventually(writer.envelope).Should(Receive())
+		Eventually(writer.envelope).Should(Receive())
+
+		cancel()
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+
+	It("writes envelopes unchanged to the V2 writer", func() {
+		v2Writer := newSpyV2Writer()
+		c := ingress.NewRLPConsumer(addr, "shard", selector, false, v2Writer, grpc.WithInsecure())
+		errs := make(chan error, 1)
+		go func() { errs <- c.Consume(context.Background(), writer) }()
+
+		var e *loggregator_v2.Envelope
+		Eventually(v2Writer.envelope).Should(Receive(&e))
+		Expect(string(e.GetLog().GetPayload())).To(Equal("hello"))
+		Expect(writer.envelope).To(BeEmpty())
+
+		Eventually(errs).Should(Receive(HaveOccurred()))
+	})
+
+	It("returns an error when the RLP cannot be reached", func() {
+		server.Stop()
+		c := ingress.NewRLPConsumer(addr, "shard", selector, false, nil, grpc.WithInsecure())
+
+		Expect(c.Consume(context.Background(), writer)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ParseSelectors", func() {
+	It("creates a selector for every envelope type", func() {
+		selectors, err := ingress.ParseSelectors(
+			[]string{"log", "counter", "gauge", "timer", "event"},
+			"",
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors).To(HaveLen(5))
+		Expect(selectors[0].GetLog()).ToNot(BeNil())
+		Expect(selectors[4].GetEvent()).ToNot(BeNil())
+	})
+
+	It("returns an error for an unknown type", func() {
+		_, err := ingress.ParseSelectors([]string{"bogus"}, "")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+type fakeRLP struct {
+	requests      chan *loggregator_v2.EgressRequest
+	batchRequests chan *loggregator_v2.EgressBatchRequest
+}
+
+func newFakeRLP() *fakeRLP {
+	return &fakeRLP{
+		requests:      make(chan *loggregator_v2.EgressRequest, 10),
+		batchRequests: make(chan *loggregator_v2.EgressBatchRequest, 10),
+	}
+}
+
+// Receiver sends a single log envelope and then ends the stream.
+func (f *fakeRLP) Receiver(
+	req *loggregator_v2.EgressRequest,
+	srv loggregator_v2.Egress_ReceiverServer,
+) error {
+	f.requests <- req
+	return srv.Send(logEnvelope("hello"))
+}
+
+// BatchedReceiver sends a batch of two log envelopes and then holds the
+// stream open.
+func (f *fakeRLP) BatchedReceiver(
+	req *loggregator_v2.EgressBatchRequest,
+	srv loggregator_v2.Egress_BatchedReceiverServer,
+) error {
+	f.batchRequests <- req
+	err := srv.Send(&loggregator_v2.EnvelopeBatch{
+		Batch: []*loggregator_v2.Envelope{
+			logEnvelope("one"),
+			logEnvelope("two"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	<-srv.Context().Done()
+	return nil
+}
+
+func logEnvelope(msg string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId:  "some-source",
+		Timestamp: 99,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{Payload: []byte(msg)},
+		},
+	}
+}
+
+func startFakeRLP(rlp *fakeRLP) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	server := grpc.NewServer()
+	loggregator_v2.RegisterEgressServer(server, rlp)
+	go server.Serve(lis)
+
+	return lis.Addr().String(), server
+}
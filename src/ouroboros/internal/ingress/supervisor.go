@@ -0,0 +1,87 @@
+package ingress
+
+import (
+	"conf"
+	"context"
+	"errors"
+	"logging"
+	"time"
+)
+
+var logger = logging.New("ingress")
+
+// ErrFinished is returned by a Consumer that has nothing left to consume,
+// e.g. a replay that has reached the end of its recordings. The Supervisor
+// stops instead of reconnecting.
+var ErrFinished = errors.New("ingress finished")
+
+type Consumer interface {
+	Consume(ctx context.Context, w EnvelopeWriter) error
+}
+
+type ReconnectCounter interface {
+	IncrementReconnects()
+}
+
+// Supervisor keeps an ingress connection open. Failed connections are
+// retried with an exponential backoff bounded by the configured range,
+// whose minimum must be above 0.
+type Supervisor struct {
+	consumer   Consumer
+	writer     EnvelopeWriter
+	reconnects ReconnectCounter
+	backoff    conf.DurationRange
+}
+
+func NewSupervisor(
+	consumer Consumer,
+	w EnvelopeWriter,
+	c ReconnectCounter,
+	backoff conf.DurationRange,
+) *Supervisor {
+	return &Supervisor{
+		consumer:   consumer,
+		writer:     w,
+		reconnects: c,
+		backoff:    backoff,
+	}
+}
+
+// Run consumes from the ingress until the context is done or the consumer
+// returns ErrFinished.
+func (s *Supervisor) Run(ctx context.Context) {
+	delay := s.backoff.Min
+	for {
+		start := time.Now()
+		err := s.consumer.Consume(ctx, s.writer)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == ErrFinished {
+			logger.Infof("Ingress finished")
+			return
+		}
+		if err != nil {
+			logger.With("error", err).Errorf("Ingress connection failed")
+		}
+
+		// A connection that stayed up longer than the largest backoff is
+		// considered healthy, so the next failure starts from scratch.
+		if time.Since(start) > s.backoff.Max {
+			delay = s.backoff.Min
+		}
+
+		logger.Infof("Reconnecting ingress in %s", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		s.reconnects.IncrementReconnects()
+
+		delay *= 2
+		if delay > s.backoff.Max {
+			delay = s.backoff.Max
+		}
+	}
+}
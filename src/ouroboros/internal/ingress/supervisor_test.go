@@ -0,0 +1,185 @@
+package ingress_test
+
+import (
+	"conf"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"ouroboros/internal/ingress"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gorilla/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Supervisor", func() {
+	var (
+		firehose   *flakyFirehose
+		server     *httptest.Server
+		tokens     *spyTokenFetcher
+		writer     *spyEnvelopeWriter
+		reconnects *spyReconnectCounter
+		supervisor *ingress.Supervisor
+	)
+
+	BeforeEach(func() {
+		firehose = newFlakyFirehose()
+		server = httptest.NewServer(firehose)
+		tokens = &spyTokenFetcher{}
+		writer = newSpyEnvelopeWriter()
+		reconnects = &spyReconnectCounter{}
+
+		supervisor = ingress.NewSupervisor(
+			ingress.NewFirehoseConsumer(
+				strings.Replace(server.URL, "http", "ws", 1),
+				"sub-id",
+				tokens,
+			),
+			writer,
+			reconnects,
+			conf.DurationRange{Min: time.Millisecond, Max: 10 * time.Millisecond},
+		)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reconnects after the firehose closes the connection", func() {
+		go supervisor.Run(context.Background())
+
+		Eventually(writer.envelope).Should(Receive())
+		Eventually(writer.envelope).Should(Receive())
+		Eventually(reconnects.count).Should(BeNumerically(">=", 1))
+	})
+
+	It("fetches a fresh token for every connection", func() {
+		go supervisor.Run(context.Background())
+
+		Eventually(firehose.tokens).Should(Receive(Equal("bearer token-1")))
+		Eventually(firehose.tokens).Should(Receive(Equal("bearer token-2")))
+	})
+
+	It("retries when a token cannot be fetched", func() {
+		tokens.failures = 2
+		go supervisor.Run(context.Background())
+
+		Eventually(firehose.tokens).Should(Receive(Equal("bearer token-3")))
+		Expect(reconnects.count()).To(BeNumerically(">=", 2))
+	})
+
+	It("stops once the consumer has finished", func() {
+		consumer := &finishedConsumer{}
+		supervisor = ingress.NewSupervisor(
+			consumer,
+			writer,
+			reconnects,
+			conf.DurationRange{Min: time.Millisecond, Max: 10 * time.Millisecond},
+		)
+
+		supervisor.Run(context.Background())
+
+		Expect(consumer.calls).To(Equal(1))
+		Expect(reconnects.count()).To(BeZero())
+	})
+
+	It("returns once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			supervisor.Run(ctx)
+			close(done)
+		}()
+
+		Eventually(writer.envelope).Should(Receive())
+		cancel()
+
+		Eventually(done).Should(BeClosed())
+	})
+})
+
+type finishedConsumer struct {
+	calls int
+}
+
+func (c *finishedConsumer) Consume(context.Context, ingress.EnvelopeWriter) error {
+	c.calls++
+	return ingress.ErrFinished
+}
+
+type flakyFirehose struct {
+	tokens chan string
+}
+
+func newFlakyFirehose() *flakyFirehose {
+	return &flakyFirehose{
+		tokens: make(chan string, 100),
+	}
+}
+
+// ServeHTTP upgrades the connection, writes a single envelope and then hangs
+// up.
+func (f *flakyFirehose) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	f.tokens <- r.Header.Get("Authorization")
+
+	// The server may be closed while the supervisor is reconnecting.
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	data, err := proto.Marshal(&events.Envelope{
+		Origin:    proto.String("some-origin"),
+		Timestamp: proto.Int64(99),
+		EventType: events.Envelope_LogMessage.Enum(),
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	conn.WriteMessage(websocket.BinaryMessage, data)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, ""), time.Now().Add(time.Second))
+}
+
+type spyTokenFetcher struct {
+	mu       sync.Mutex
+	calls    int
+	failures int
+}
+
+func (s *spyTokenFetcher) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls <= s.failures {
+		return "", errors.New("uaa is down")
+	}
+
+	return fmt.Sprintf("bearer token-%d", s.calls), nil
+}
+
+type spyReconnectCounter struct {
+	mu         sync.Mutex
+	reconnects int
+}
+
+func (s *spyReconnectCounter) IncrementReconnects() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reconnects++
+}
+
+func (s *spyReconnectCounter) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reconnects
+}
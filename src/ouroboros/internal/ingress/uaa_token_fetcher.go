@@ -0,0 +1,31 @@
+package ingress
+
+import (
+	"github.com/cloudfoundry-incubator/uaago"
+)
+
+// UAATokenFetcher fetches firehose tokens from UAA using client
+// credentials.
+type UAATokenFetcher struct {
+	client       *uaago.Client
+	clientID     string
+	clientSecret string
+}
+
+func NewUAATokenFetcher(addr, clientID, clientSecret string) (*UAATokenFetcher, error) {
+	client, err := uaago.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UAATokenFetcher{
+		client:       client,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}, nil
+}
+
+// Token returns a fresh token from UAA.
+func (f *UAATokenFetcher) Token() (string, error) {
+	return f.client.GetAuthToken(f.clientID, f.clientSecret, true)
+}
@@ -1,8 +1,9 @@
 package ingress
 
 import (
+	"context"
 	"crypto/tls"
-	"log"
+	"errors"
 
 	"github.com/cloudfoundry/noaa/consumer"
 	"github.com/cloudfoundry/sonde-go/events"
@@ -12,16 +13,58 @@ type EnvelopeWriter interface {
 	Write(e *events.Envelope)
 }
 
-func Consume(addr, subId, token string, w EnvelopeWriter) {
-	consumer := consumer.New(addr, &tls.Config{InsecureSkipVerify: true}, nil)
-	msgChan, errorChan := consumer.Firehose(subId, token)
-	go func() {
-		for err := range errorChan {
-			log.Fatalf("Error received from firehose consumer: %s", err)
-		}
-	}()
+type TokenFetcher interface {
+	Token() (string, error)
+}
+
+// FirehoseConsumer is a Consumer that reads from the V1 firehose. Every
+// connection uses a freshly fetched token.
+type FirehoseConsumer struct {
+	addr   string
+	subID  string
+	tokens TokenFetcher
+}
+
+func NewFirehoseConsumer(addr, subID string, t TokenFetcher) *FirehoseConsumer {
+	return &FirehoseConsumer{
+		addr:   addr,
+		subID:  subID,
+		tokens: t,
+	}
+}
 
-	for msg := range msgChan {
-		w.Write(msg)
+func (c *FirehoseConsumer) Consume(ctx context.Context, w EnvelopeWriter) error {
+	token, err := c.tokens.Token()
+	if err != nil {
+		return err
+	}
+
+	return Consume(ctx, c.addr, c.subID, token, w)
+}
+
+// Consume reads from the firehose and writes every envelope to the
+// EnvelopeWriter. It returns the first error reported by the firehose
+// consumer, or nil once the context is done, after which the connection is
+// closed.
+func Consume(ctx context.Context, addr, subId, token string, w EnvelopeWriter) error {
+	c := consumer.New(addr, &tls.Config{InsecureSkipVerify: true}, nil)
+	defer c.Close()
+
+	msgChan, errorChan := c.Firehose(subId, token)
+	for {
+		select {
+		case msg, ok := <-msgChan:
+			if !ok {
+				return errors.New("firehose message channel closed")
+			}
+			w.Write(msg)
+		case err, ok := <-errorChan:
+			if !ok {
+				return errors.New("firehose error channel closed")
+			}
+			return err
+		case <-ctx.Done():
+			return nil
+		}
 	}
 }
@@ -1,6 +1,7 @@
 package ingress_test
 
 import (
+	"context"
 	"log"
 	"net/http/httptest"
 	"ouroboros/internal/ingress"
@@ -18,6 +19,8 @@ var _ = Describe("WebsocketConsumer", func() {
 		wsServer  *httptest.Server
 
 		spyEnvelopeWriter *spyEnvelopeWriter
+		consumeErrs       chan error
+		cancel            context.CancelFunc
 	)
 
 	BeforeEach(func() {
@@ -39,12 +42,26 @@ var _ = Describe("WebsocketConsumer", func() {
 		Expect(err).ToNot(HaveOccurred())
 
 		go serveDataUp(wsHandler, data)
-		go ingress.Consume(
-			strings.Replace(wsServer.URL, "http", "ws", -1),
-			"sub-id",
-			"Bearer some-good-token",
-			spyEnvelopeWriter,
-		)
+		errs := make(chan error, 1)
+		consumeErrs = errs
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		url := strings.Replace(wsServer.URL, "http", "ws", -1)
+		w := spyEnvelopeWriter
+		go func() {
+			errs <- ingress.Consume(
+				ctx,
+				url,
+				"sub-id",
+				"Bearer some-good-token",
+				w,
+			)
+		}()
+	})
+
+	AfterEach(func() {
+		cancel()
+		wsServer.Close()
 	})
 
 	It("reads data from the websocket and writes it to the EnvelopeWriter", func() {
@@ -53,6 +70,23 @@ var _ = Describe("WebsocketConsumer", func() {
 		Expect(e.GetOrigin()).To(Equal("some-origin"))
 		Expect(e.GetTimestamp()).To(Equal(int64(99)))
 	})
+
+	It("returns an error when the firehose connection is lost", func() {
+		close(wsHandler.done)
+
+		Eventually(consumeErrs, 5).Should(Receive(HaveOccurred()))
+	})
+
+	It("returns without an error when the context is done", func() {
+		Eventually(spyEnvelopeWriter.envelope).Should(Receive())
+		cancel()
+
+		// Keep draining so a full writer does not hide the cancellation.
+		Eventually(func() <-chan error {
+			toSlice(spyEnvelopeWriter.envelope)
+			return consumeErrs
+		}).Should(Receive(BeNil()))
+	})
 })
 
 func serveDataUp(server *testWebsocketHandler, data []byte) {
@@ -0,0 +1,75 @@
+package loop
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// latencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram buckets. Latencies above the last bound fall in an overflow
+// bucket.
+var latencyBounds = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Bucket is a histogram bucket holding the number of latencies at or below
+// LE milliseconds and above the previous bucket's bound. The overflow
+// bucket has an LE of "+Inf".
+type Bucket struct {
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+type histogram struct {
+	counts []uint64
+	total  uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]uint64, len(latencyBounds)+1),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+
+	i := 0
+	for i < len(latencyBounds) && ms > latencyBounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.total++
+}
+
+// percentile returns the upper bound, in milliseconds, of the bucket
+// holding the pth percentile, or 0 if nothing has been observed. The
+// overflow bucket is reported as the last bound.
+func (h *histogram) percentile(p float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(p / 100 * float64(h.total)))
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		if cumulative >= target && i < len(latencyBounds) {
+			return latencyBounds[i]
+		}
+	}
+
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+func (h *histogram) buckets() []Bucket {
+	buckets := make([]Bucket, len(h.counts))
+	for i, c := range h.counts {
+		le := "+Inf"
+		if i < len(latencyBounds) {
+			le = strconv.FormatFloat(latencyBounds[i], 'f', -1, 64)
+		}
+		buckets[i] = Bucket{LE: le, Count: c}
+	}
+
+	return buckets
+}
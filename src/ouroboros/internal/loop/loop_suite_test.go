@@ -0,0 +1,17 @@
+package loop_test
+
+import (
+	"log"
+	"logging"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestLoop(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	logging.SetOutput(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ouroboros - Loop Suite")
+}
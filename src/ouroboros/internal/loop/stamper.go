@@ -0,0 +1,47 @@
+package loop
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// Tags ouroboros uses to recognise its own envelopes when they come back
+// around the loop.
+const (
+	InstanceTag = "ouroboros_instance"
+	SequenceTag = "ouroboros_seq"
+	SentTag     = "ouroboros_sent"
+)
+
+type EnvelopeWriter interface {
+	Write(e *events.Envelope)
+}
+
+// Stamper tags every envelope it writes with the instance ID, a sequence
+// number starting at 1 and the time it was sent.
+type Stamper struct {
+	instanceID string
+	seq        uint64
+	writer     EnvelopeWriter
+}
+
+func NewStamper(instanceID string, w EnvelopeWriter) *Stamper {
+	return &Stamper{
+		instanceID: instanceID,
+		writer:     w,
+	}
+}
+
+func (s *Stamper) Write(e *events.Envelope) {
+	if e.Tags == nil {
+		e.Tags = make(map[string]string)
+	}
+	e.Tags[InstanceTag] = s.instanceID
+	e.Tags[SequenceTag] = strconv.FormatUint(atomic.AddUint64(&s.seq, 1), 10)
+	e.Tags[SentTag] = strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	s.writer.Write(e)
+}
@@ -0,0 +1,51 @@
+package loop_test
+
+import (
+	"ouroboros/internal/loop"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stamper", func() {
+	It("tags envelopes with the instance, a sequence number and the send time", func() {
+		writer := &spyEnvelopeWriter{}
+		s := loop.NewStamper("instance-a", writer)
+
+		s.Write(logEnvelope(map[string]string{"other": "tag"}))
+		s.Write(logEnvelope(nil))
+
+		Expect(writer.envelopes).To(HaveLen(2))
+		first := writer.envelopes[0].GetTags()
+		Expect(first).To(HaveKeyWithValue("ouroboros_instance", "instance-a"))
+		Expect(first).To(HaveKeyWithValue("ouroboros_seq", "1"))
+		Expect(first).To(HaveKeyWithValue("other", "tag"))
+		Expect(writer.envelopes[1].GetTags()).To(HaveKeyWithValue("ouroboros_seq", "2"))
+
+		sent, err := strconv.ParseInt(first["ouroboros_sent"], 10, 64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Unix(0, sent)).To(BeTemporally("~", time.Now(), time.Second))
+	})
+})
+
+type spyEnvelopeWriter struct {
+	envelopes []*events.Envelope
+}
+
+func (s *spyEnvelopeWriter) Write(e *events.Envelope) {
+	s.envelopes = append(s.envelopes, e)
+}
+
+func logEnvelope(tags map[string]string) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("some-origin"),
+		Timestamp: proto.Int64(99),
+		EventType: events.Envelope_LogMessage.Enum(),
+		Tags:      tags,
+	}
+}
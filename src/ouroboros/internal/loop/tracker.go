@@ -0,0 +1,163 @@
+package loop
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// seenWindow is how many sequence numbers below the highest one seen are
+// remembered for duplicate detection.
+const seenWindow = 100000
+
+type ValueEmitter interface {
+	EmitValue(name string, value float64, unit string)
+}
+
+// Tracker watches envelopes coming back from the ingress for those stamped
+// by the Stamper with the same instance ID, and measures how reliably and
+// how quickly they travelled around the loop. Every envelope is passed on
+// to the writer unchanged.
+//
+// Loss is measured against the highest sequence number seen, so envelopes
+// still in flight are not counted as lost. Instances sharing a firehose
+// subscription each only see part of the loop, which shows up as loss.
+type Tracker struct {
+	instanceID string
+	writer     EnvelopeWriter
+
+	mu         sync.Mutex
+	received   uint64
+	duplicates uint64
+	reordered  uint64
+	highest    uint64
+	seen       map[uint64]bool
+	latency    *histogram
+}
+
+// Snapshot is a point in time view of a Tracker's measurements.
+type Snapshot struct {
+	Received    uint64   `json:"received"`
+	Lost        uint64   `json:"lost"`
+	LossPercent float64  `json:"loss_percent"`
+	Duplicates  uint64   `json:"duplicates"`
+	Reordered   uint64   `json:"reordered"`
+	LatencyP50  float64  `json:"latency_p50_ms"`
+	LatencyP90  float64  `json:"latency_p90_ms"`
+	LatencyP99  float64  `json:"latency_p99_ms"`
+	Latency     []Bucket `json:"latency_ms"`
+}
+
+func NewTracker(instanceID string, w EnvelopeWriter) *Tracker {
+	return &Tracker{
+		instanceID: instanceID,
+		writer:     w,
+		seen:       make(map[uint64]bool),
+		latency:    newHistogram(),
+	}
+}
+
+func (t *Tracker) Write(e *events.Envelope) {
+	tags := e.GetTags()
+	if tags[InstanceTag] == t.instanceID {
+		seq, seqErr := strconv.ParseUint(tags[SequenceTag], 10, 64)
+		sent, sentErr := strconv.ParseInt(tags[SentTag], 10, 64)
+		if seqErr == nil && sentErr == nil {
+			t.record(seq, time.Since(time.Unix(0, sent)))
+		}
+	}
+
+	t.writer.Write(e)
+}
+
+func (t *Tracker) record(seq uint64, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seen[seq] {
+		t.duplicates++
+		return
+	}
+
+	t.received++
+	t.latency.observe(latency)
+
+	if seq < t.highest {
+		t.reordered++
+	}
+
+	if seq+seenWindow > t.highest {
+		t.seen[seq] = true
+	}
+
+	if seq > t.highest {
+		for s := t.lowestRemembered(); s+seenWindow <= seq; s++ {
+			delete(t.seen, s)
+		}
+		t.highest = seq
+	}
+}
+
+func (t *Tracker) lowestRemembered() uint64 {
+	if t.highest < seenWindow {
+		return 0
+	}
+
+	return t.highest - seenWindow
+}
+
+// Snapshot returns the measurements so far.
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Snapshot{
+		Received:   t.received,
+		Duplicates: t.duplicates,
+		Reordered:  t.reordered,
+		LatencyP50: t.latency.percentile(50),
+		LatencyP90: t.latency.percentile(90),
+		LatencyP99: t.latency.percentile(99),
+		Latency:    t.latency.buckets(),
+	}
+
+	if t.highest > t.received {
+		s.Lost = t.highest - t.received
+	}
+	if t.highest > 0 {
+		s.LossPercent = float64(s.Lost) / float64(t.highest) * 100
+	}
+
+	return s
+}
+
+// Report emits the measurements as ValueMetrics.
+func (t *Tracker) Report(e ValueEmitter) {
+	s := t.Snapshot()
+
+	e.EmitValue("loop_received", float64(s.Received), "count")
+	e.EmitValue("loop_loss_percent", s.LossPercent, "percent")
+	e.EmitValue("loop_duplicates", float64(s.Duplicates), "count")
+	e.EmitValue("loop_reordered", float64(s.Reordered), "count")
+	e.EmitValue("loop_latency_p50", s.LatencyP50, "ms")
+	e.EmitValue("loop_latency_p90", s.LatencyP90, "ms")
+	e.EmitValue("loop_latency_p99", s.LatencyP99, "ms")
+}
+
+// ReportEvery calls Report on the interval until the context is done.
+func (t *Tracker) ReportEvery(ctx context.Context, d time.Duration, e ValueEmitter) {
+	tick := time.NewTicker(d)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			t.Report(e)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package loop_test
+
+import (
+	"context"
+	"ouroboros/internal/loop"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracker", func() {
+	var (
+		writer  *spyEnvelopeWriter
+		tracker *loop.Tracker
+	)
+
+	BeforeEach(func() {
+		writer = &spyEnvelopeWriter{}
+		tracker = loop.NewTracker("instance-a", writer)
+	})
+
+	returned := func(instance string, seq uint64, latency time.Duration) {
+		tracker.Write(logEnvelope(map[string]string{
+			"ouroboros_instance": instance,
+			"ouroboros_seq":      strconv.FormatUint(seq, 10),
+			"ouroboros_sent":     strconv.FormatInt(time.Now().Add(-latency).UnixNano(), 10),
+		}))
+	}
+
+	It("passes every envelope on", func() {
+		returned("instance-a", 1, time.Millisecond)
+		tracker.Write(logEnvelope(nil))
+
+		Expect(writer.envelopes).To(HaveLen(2))
+	})
+
+	It("measures loss against the highest sequence number", func() {
+		returned("instance-a", 1, time.Millisecond)
+		returned("instance-a", 2, time.Millisecond)
+		returned("instance-a", 4, time.Millisecond)
+
+		s := tracker.Snapshot()
+		Expect(s.Received).To(Equal(uint64(3)))
+		Expect(s.Lost).To(Equal(uint64(1)))
+		Expect(s.LossPercent).To(Equal(25.0))
+	})
+
+	It("counts duplicates and reordered envelopes", func() {
+		returned("instance-a", 2, time.Millisecond)
+		returned("instance-a", 1, time.Millisecond)
+		returned("instance-a", 2, time.Millisecond)
+
+		s := tracker.Snapshot()
+		Expect(s.Received).To(Equal(uint64(2)))
+		Expect(s.Duplicates).To(Equal(uint64(1)))
+		Expect(s.Reordered).To(Equal(uint64(1)))
+		Expect(s.Lost).To(BeZero())
+	})
+
+	It("ignores envelopes stamped by other instances", func() {
+		returned("instance-b", 5, time.Millisecond)
+
+		Expect(tracker.Snapshot().Received).To(BeZero())
+	})
+
+	It("builds a latency histogram", func() {
+		for i := uint64(1); i <= 9; i++ {
+			returned("instance-a", i, 20*time.Millisecond)
+		}
+		returned("instance-a", 10, 2*time.Second)
+
+		s := tracker.Snapshot()
+		Expect(s.LatencyP50).To(Equal(25.0))
+		Expect(s.LatencyP90).To(Equal(25.0))
+		Expect(s.LatencyP99).To(Equal(2500.0))
+		Expect(s.Latency).To(ContainElement(loop.Bucket{LE: "25", Count: 9}))
+		Expect(s.Latency).To(ContainElement(loop.Bucket{LE: "+Inf", Count: 0}))
+	})
+
+	It("reports the measurements as value metrics", func() {
+		returned("instance-a", 1, time.Millisecond)
+		returned("instance-a", 3, time.Millisecond)
+
+		emitter := &spyValueEmitter{values: make(map[string]float64)}
+		tracker.Report(emitter)
+
+		Expect(emitter.values).To(HaveKeyWithValue("loop_loss_percent", BeNumerically("~", 33.3, 0.1)))
+		Expect(emitter.values).To(HaveKeyWithValue("loop_received", 2.0))
+		Expect(emitter.values).To(HaveKey("loop_latency_p99"))
+	})
+
+	It("reports on the interval until the context is done", func() {
+		returned("instance-a", 1, time.Millisecond)
+
+		emitter := &spyValueEmitter{values: make(map[string]float64)}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			tracker.ReportEvery(ctx, time.Millisecond, emitter)
+			close(done)
+		}()
+
+		Eventually(done).Should(BeClosed())
+		Expect(emitter.values).To(HaveKeyWithValue("loop_received", 1.0))
+	})
+})
+
+type spyValueEmitter struct {
+	values map[string]float64
+}
+
+func (s *spyValueEmitter) EmitValue(name string, value float64, unit string) {
+	s.values[name] = value
+}
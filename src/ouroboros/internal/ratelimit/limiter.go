@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Limiter is a token bucket. Tokens are added at the configured rate up to
+// a burst of one tenth of a second's worth of tokens.
+type Limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate float64) *Limiter {
+	l := &Limiter{last: time.Now()}
+	l.SetRate(rate)
+	l.tokens = l.burst
+
+	return l
+}
+
+// SetRate changes the rate at which tokens are added.
+func (l *Limiter) SetRate(rate float64) {
+	l.rate = rate
+	l.burst = rate / 10
+	if l.burst < 1 {
+		l.burst = 1
+	}
+}
+
+// Allow takes a token if one is available.
+func (l *Limiter) Allow() bool {
+	l.refill()
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+// Reserve takes a token and returns how long the caller must wait before
+// the token is available.
+func (l *Limiter) Reserve() time.Duration {
+	l.refill()
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *Limiter) refill() {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
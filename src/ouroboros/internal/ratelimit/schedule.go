@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Step is a rate, in envelopes per second, held for a duration. A step
+// without a duration is held forever.
+type Step struct {
+	Rate     float64
+	Duration time.Duration
+}
+
+// Schedule is a series of steps used to ramp the egress rate up or down
+// over time.
+type Schedule []Step
+
+// UnmarshalEnv parses a schedule of the format {rate}:{duration},...,{rate}
+// e.g. "1000:5m,5000:5m,10000" writes 1000 envelopes per second for five
+// minutes, then 5000 per second for five minutes, and then 10000 per
+// second.
+func (s *Schedule) UnmarshalEnv(v string) error {
+	var steps Schedule
+	for _, step := range strings.Split(v, ",") {
+		values := strings.Split(strings.TrimSpace(step), ":")
+		if len(values) > 2 {
+			return fmt.Errorf("Expected Schedule step to be of format {rate}:{duration}")
+		}
+
+		rate, err := strconv.ParseFloat(values[0], 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("Error parsing Schedule rate: %s", values[0])
+		}
+
+		var d time.Duration
+		if len(values) == 2 {
+			d, err = time.ParseDuration(values[1])
+			if err != nil {
+				return fmt.Errorf("Error parsing Schedule duration: %s", err)
+			}
+		}
+
+		steps = append(steps, Step{Rate: rate, Duration: d})
+	}
+
+	*s = steps
+	return nil
+}
+
+// RateAt returns the rate for the given time since the schedule started.
+// Once every step has elapsed the rate of the last step is used.
+func (s Schedule) RateAt(elapsed time.Duration) float64 {
+	for _, step := range s {
+		if step.Duration == 0 || elapsed < step.Duration {
+			return step.Rate
+		}
+		elapsed -= step.Duration
+	}
+
+	return s[len(s)-1].Rate
+}
@@ -0,0 +1,55 @@
+package ratelimit_test
+
+import (
+	"ouroboros/internal/ratelimit"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schedule", func() {
+	It("parses a schedule of rates and durations", func() {
+		var s ratelimit.Schedule
+		err := s.UnmarshalEnv("1000:5m, 5000:30s,10000")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(s).To(Equal(ratelimit.Schedule{
+			{Rate: 1000, Duration: 5 * time.Minute},
+			{Rate: 5000, Duration: 30 * time.Second},
+			{Rate: 10000},
+		}))
+	})
+
+	DescribeTable("returns an error for invalid schedules", func(v string) {
+		var s ratelimit.Schedule
+		Expect(s.UnmarshalEnv(v)).ToNot(Succeed())
+	},
+		Entry("invalid rate", "fast:5m"),
+		Entry("zero rate", "0:5m"),
+		Entry("invalid duration", "1000:forever"),
+		Entry("too many values", "1000:5m:1m"),
+	)
+
+	It("returns the rate of the current step", func() {
+		s := ratelimit.Schedule{
+			{Rate: 1000, Duration: 5 * time.Minute},
+			{Rate: 5000, Duration: 5 * time.Minute},
+			{Rate: 10000},
+		}
+
+		Expect(s.RateAt(0)).To(Equal(1000.0))
+		Expect(s.RateAt(6 * time.Minute)).To(Equal(5000.0))
+		Expect(s.RateAt(time.Hour)).To(Equal(10000.0))
+	})
+
+	It("holds the last rate once the schedule has elapsed", func() {
+		s := ratelimit.Schedule{
+			{Rate: 1000, Duration: time.Minute},
+			{Rate: 2000, Duration: time.Minute},
+		}
+
+		Expect(s.RateAt(time.Hour)).To(Equal(2000.0))
+	})
+})
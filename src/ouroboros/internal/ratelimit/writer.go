@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"logging"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+var logger = logging.New("ratelimit")
+
+type EnvelopeWriter interface {
+	Write(e *events.Envelope)
+}
+
+type CounterEmitter interface {
+	EmitCounter(name string, delta uint64)
+}
+
+// Writer shapes egress traffic to follow a Schedule. Envelopes over the
+// current rate are either delayed until they fit or dropped.
+type Writer struct {
+	schedule    Schedule
+	limiter     *Limiter
+	drop        bool
+	start       time.Time
+	rate        float64
+	reportCount uint64
+	dropped     uint64
+	delayed     uint64
+	writer      EnvelopeWriter
+	emitter     CounterEmitter
+}
+
+// NewWriter creates a Writer that follows the schedule from the time it is
+// created. The number of dropped and delayed envelopes are emitted through
+// the CounterEmitter every reportCount envelopes.
+func NewWriter(
+	s Schedule,
+	drop bool,
+	reportCount uint64,
+	w EnvelopeWriter,
+	e CounterEmitter,
+) *Writer {
+	rate := s.RateAt(0)
+	logger.Infof("Limiting egress to %.0f envelopes per second", rate)
+
+	return &Writer{
+		schedule:    s,
+		limiter:     NewLimiter(rate),
+		drop:        drop,
+		start:       time.Now(),
+		rate:        rate,
+		reportCount: reportCount,
+		writer:      w,
+		emitter:     e,
+	}
+}
+
+func (w *Writer) Write(e *events.Envelope) {
+	w.updateRate()
+
+	if w.drop {
+		if !w.limiter.Allow() {
+			w.dropped++
+			w.report("egress_dropped", w.dropped)
+			return
+		}
+		w.writer.Write(e)
+		return
+	}
+
+	if wait := w.limiter.Reserve(); wait > 0 {
+		w.delayed++
+		w.report("egress_delayed", w.delayed)
+		time.Sleep(wait)
+	}
+	w.writer.Write(e)
+}
+
+func (w *Writer) updateRate() {
+	rate := w.schedule.RateAt(time.Since(w.start))
+	if rate == w.rate {
+		return
+	}
+
+	logger.Infof("Limiting egress to %.0f envelopes per second", rate)
+	w.rate = rate
+	w.limiter.SetRate(rate)
+}
+
+func (w *Writer) report(name string, count uint64) {
+	if count%w.reportCount == 0 {
+		w.emitter.EmitCounter(name, w.reportCount)
+	}
+}
@@ -0,0 +1,105 @@
+package ratelimit_test
+
+import (
+	"ouroboros/internal/ratelimit"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		writer  *spyEnvelopeWriter
+		emitter *spyCounterEmitter
+	)
+
+	BeforeEach(func() {
+		writer = &spyEnvelopeWriter{}
+		emitter = &spyCounterEmitter{counters: make(map[string]uint64)}
+	})
+
+	Context("in drop mode", func() {
+		It("drops envelopes over the rate", func() {
+			w := ratelimit.NewWriter(ratelimit.Schedule{{Rate: 100}}, true, 10, writer, emitter)
+
+			for i := 0; i < 100; i++ {
+				w.Write(newEnvelope())
+			}
+
+			Expect(writer.count).To(BeNumerically("~", 10, 2))
+		})
+
+		It("emits the number of dropped envelopes", func() {
+			w := ratelimit.NewWriter(ratelimit.Schedule{{Rate: 100}}, true, 10, writer, emitter)
+
+			for i := 0; i < 100; i++ {
+				w.Write(newEnvelope())
+			}
+
+			Expect(emitter.counters["egress_dropped"]).To(BeNumerically(">=", 80))
+			Expect(emitter.counters["egress_dropped"] % 10).To(BeZero())
+		})
+	})
+
+	Context("in delay mode", func() {
+		It("writes every envelope at the scheduled rate", func() {
+			w := ratelimit.NewWriter(ratelimit.Schedule{{Rate: 1000}}, false, 10, writer, emitter)
+
+			start := time.Now()
+			for i := 0; i < 300; i++ {
+				w.Write(newEnvelope())
+			}
+
+			Expect(writer.count).To(Equal(300))
+			Expect(time.Since(start)).To(BeNumerically(">=", 150*time.Millisecond))
+			Expect(emitter.counters["egress_delayed"]).To(BeNumerically(">=", 100))
+		})
+	})
+
+	It("follows the schedule", func() {
+		w := ratelimit.NewWriter(ratelimit.Schedule{
+			{Rate: 10, Duration: 100 * time.Millisecond},
+			{Rate: 100000},
+		}, true, 10, writer, emitter)
+
+		for i := 0; i < 100; i++ {
+			w.Write(newEnvelope())
+		}
+		Expect(writer.count).To(BeNumerically("<", 5))
+
+		time.Sleep(150 * time.Millisecond)
+		writer.count = 0
+		for i := 0; i < 100; i++ {
+			w.Write(newEnvelope())
+		}
+		Expect(writer.count).To(Equal(100))
+	})
+})
+
+func newEnvelope() *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("some-origin"),
+		Timestamp: proto.Int64(99),
+		EventType: events.Envelope_LogMessage.Enum(),
+	}
+}
+
+type spyEnvelopeWriter struct {
+	count int
+}
+
+func (s *spyEnvelopeWriter) Write(e *events.Envelope) {
+	s.count++
+}
+
+type spyCounterEmitter struct {
+	counters map[string]uint64
+}
+
+func (s *spyCounterEmitter) EmitCounter(name string, delta uint64) {
+	s.counters[name] += delta
+}
@@ -0,0 +1,63 @@
+package recording
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+)
+
+// A record is the time the envelope was received as little endian int64
+// nanoseconds, the length of the marshalled envelope as a little endian
+// uint32, and the marshalled envelope.
+const headerSize = 8 + 4
+
+// maxRecordSize guards against allocating huge buffers for corrupt files.
+const maxRecordSize = 64 * 1024 * 1024
+
+func marshalRecord(t time.Time, e *events.Envelope) ([]byte, error) {
+	data, err := proto.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, headerSize+len(data))
+	binary.LittleEndian.PutUint64(record, uint64(t.UnixNano()))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(data)))
+	copy(record[headerSize:], data)
+
+	return record, nil
+}
+
+// readRecord reads the next record. It returns io.EOF when there are no
+// more records and io.ErrUnexpectedEOF when the last record is truncated.
+func readRecord(r io.Reader) (time.Time, *events.Envelope, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	t := time.Unix(0, int64(binary.LittleEndian.Uint64(header)))
+	size := binary.LittleEndian.Uint32(header[8:])
+	if size > maxRecordSize {
+		return time.Time{}, nil, fmt.Errorf("record of %d bytes is too large", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return time.Time{}, nil, err
+	}
+
+	var e events.Envelope
+	if err := proto.Unmarshal(data, &e); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	return t, &e, nil
+}
@@ -0,0 +1,130 @@
+package recording
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"logging"
+	"os"
+	"ouroboros/internal/ingress"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+var logger = logging.New("recording")
+
+// Recorder writes every envelope to files in a directory before passing it
+// on to the writer. A new file is started once the current one has had
+// maxFileSize bytes of records written to it. Files are gzip compressed
+// when compress is set.
+type Recorder struct {
+	dir         string
+	maxFileSize int64
+	compress    bool
+	writer      ingress.EnvelopeWriter
+
+	file    *os.File
+	buf     *bufio.Writer
+	gz      *gzip.Writer
+	written int64
+}
+
+func NewRecorder(dir string, maxFileSize int64, compress bool, w ingress.EnvelopeWriter) *Recorder {
+	return &Recorder{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		compress:    compress,
+		writer:      w,
+	}
+}
+
+// Write records the envelope with the time it was received. If it cannot
+// be recorded the failure is logged and the envelope is still passed on.
+func (r *Recorder) Write(e *events.Envelope) {
+	if err := r.record(time.Now(), e); err != nil {
+		logger.With("error", err).Errorf("Unable to record envelope")
+	}
+
+	r.writer.Write(e)
+}
+
+// Close flushes and closes the current file.
+func (r *Recorder) Close() error {
+	return r.closeFile()
+}
+
+func (r *Recorder) record(t time.Time, e *events.Envelope) error {
+	record, err := marshalRecord(t, e)
+	if err != nil {
+		return err
+	}
+
+	if r.file != nil && r.written >= r.maxFileSize {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+
+	if r.file == nil {
+		if err := r.openFile(t); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = r.buf
+	if r.gz != nil {
+		w = r.gz
+	}
+
+	n, err := w.Write(record)
+	r.written += int64(n)
+	return err
+}
+
+func (r *Recorder) openFile(t time.Time) error {
+	name := fmt.Sprintf("ouroboros-%020d.rec", t.UnixNano())
+	if r.compress {
+		name += ".gz"
+	}
+
+	f, err := os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	logger.With("file", f.Name()).Infof("Recording envelopes")
+
+	r.file = f
+	r.buf = bufio.NewWriter(f)
+	if r.compress {
+		r.gz = gzip.NewWriter(r.buf)
+	}
+	r.written = 0
+
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	var err error
+	if r.gz != nil {
+		err = r.gz.Close()
+	}
+	if flushErr := r.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	r.file = nil
+	r.buf = nil
+	r.gz = nil
+
+	return err
+}
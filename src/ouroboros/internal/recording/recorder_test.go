@@ -0,0 +1,111 @@
+package recording_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"ouroboros/internal/recording"
+	"path/filepath"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recorder", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "recording")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("passes envelopes on to the writer", func() {
+		writer := &spyWriter{}
+		r := recording.NewRecorder(dir, 1024*1024, false, writer)
+
+		r.Write(envelope("a"))
+		r.Write(envelope("b"))
+		Expect(r.Close()).To(Succeed())
+
+		Expect(writer.origins()).To(Equal([]string{"a", "b"}))
+	})
+
+	It("still passes envelopes on when they cannot be recorded", func() {
+		writer := &spyWriter{}
+		r := recording.NewRecorder(filepath.Join(dir, "missing"), 1024*1024, false, writer)
+
+		r.Write(envelope("a"))
+
+		Expect(writer.origins()).To(Equal([]string{"a"}))
+	})
+
+	It("rotates files once they reach the maximum size", func() {
+		r := recording.NewRecorder(dir, 1, false, &spyWriter{})
+
+		r.Write(envelope("a"))
+		r.Write(envelope("b"))
+		r.Write(envelope("c"))
+		Expect(r.Close()).To(Succeed())
+
+		files, err := filepath.Glob(filepath.Join(dir, "ouroboros-*.rec"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(3))
+	})
+
+	It("gzip compresses files", func() {
+		r := recording.NewRecorder(dir, 1024*1024, true, &spyWriter{})
+
+		r.Write(envelope("a"))
+		Expect(r.Close()).To(Succeed())
+
+		files, err := filepath.Glob(filepath.Join(dir, "ouroboros-*.rec.gz"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+
+		f, err := os.Open(files[0])
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(gz)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).ToNot(BeEmpty())
+	})
+})
+
+type spyWriter struct {
+	envelopes []*events.Envelope
+}
+
+func (w *spyWriter) Write(e *events.Envelope) {
+	w.envelopes = append(w.envelopes, e)
+}
+
+func (w *spyWriter) origins() []string {
+	var origins []string
+	for _, e := range w.envelopes {
+		origins = append(origins, e.GetOrigin())
+	}
+
+	return origins
+}
+
+func envelope(origin string) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String(origin),
+		EventType: events.Envelope_LogMessage.Enum(),
+		LogMessage: &events.LogMessage{
+			Message:     []byte("hello"),
+			MessageType: events.LogMessage_OUT.Enum(),
+			Timestamp:   proto.Int64(1),
+		},
+	}
+}
@@ -0,0 +1,17 @@
+package recording_test
+
+import (
+	"log"
+	"logging"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRecording(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	logging.SetOutput(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ouroboros - Recording Suite")
+}
@@ -0,0 +1,166 @@
+package recording
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"ouroboros/internal/ingress"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Replayer is an ingress Consumer that reads back the envelopes recorded by
+// a Recorder. Envelopes are written with the same spacing they were
+// recorded with, divided by speed. A speed of 0 writes them as fast as
+// possible. If loop is set the recordings are replayed over and over,
+// otherwise the Replayer finishes after the last one.
+type Replayer struct {
+	dir   string
+	speed float64
+	loop  bool
+}
+
+func NewReplayer(dir string, speed float64, loop bool) *Replayer {
+	return &Replayer{
+		dir:   dir,
+		speed: speed,
+		loop:  loop,
+	}
+}
+
+// Consume replays every recording in the directory in the order they were
+// recorded. Once they have all been replayed it returns ingress.ErrFinished
+// so the Supervisor stops, or starts over if the Replayer loops. Starting
+// over is part of the same connection, so it is not counted as a
+// reconnect. Consume returns nil once the context is done.
+func (r *Replayer) Consume(ctx context.Context, w ingress.EnvelopeWriter) error {
+	for {
+		if err := r.replayAll(ctx, w); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !r.loop {
+			return ingress.ErrFinished
+		}
+
+		logger.Infof("Replaying recordings again")
+	}
+}
+
+// replayAll replays every recording once. Recordings are listed again on
+// every pass.
+func (r *Replayer) replayAll(ctx context.Context, w ingress.EnvelopeWriter) error {
+	files, err := recordings(r.dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no recordings in %s", r.dir)
+	}
+
+	c := clock{speed: r.speed}
+	for _, f := range files {
+		logger.With("file", f).Infof("Replaying envelopes")
+		if err := r.replay(ctx, f, &c, w); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (r *Replayer) replay(ctx context.Context, path string, c *clock, w ingress.EnvelopeWriter) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var reader io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	for {
+		t, e, err := readRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			// A recording that was not closed cleanly ends part way
+			// through a record.
+			logger.With("file", path).Warnf("Recording ends with a truncated record")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		if !c.wait(ctx, t) {
+			return nil
+		}
+		w.Write(e)
+	}
+}
+
+// recordings returns the recordings in the directory, oldest first.
+func recordings(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "ouroboros-*.rec*"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// clock paces replayed envelopes relative to the first one.
+type clock struct {
+	speed         float64
+	start         time.Time
+	firstRecorded time.Time
+}
+
+// wait blocks until it is time to replay an envelope recorded at t. It
+// returns false if the context is done first.
+func (c *clock) wait(ctx context.Context, t time.Time) bool {
+	if c.speed <= 0 {
+		return ctx.Err() == nil
+	}
+
+	if c.start.IsZero() {
+		c.start = time.Now()
+		c.firstRecorded = t
+	}
+
+	offset := time.Duration(float64(t.Sub(c.firstRecorded)) / c.speed)
+	d := time.Until(c.start.Add(offset))
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,121 @@
+package recording_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"ouroboros/internal/ingress"
+	"ouroboros/internal/recording"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Replayer", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "recording")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	record := func(compress bool, maxFileSize int64, gap time.Duration, origins ...string) {
+		r := recording.NewRecorder(dir, maxFileSize, compress, &spyWriter{})
+		for i, o := range origins {
+			if i > 0 {
+				time.Sleep(gap)
+			}
+			r.Write(envelope(o))
+		}
+		Expect(r.Close()).To(Succeed())
+	}
+
+	DescribeTable("replays recordings in order", func(compress bool, maxFileSize int64) {
+		record(compress, maxFileSize, 0, "a", "b", "c")
+		writer := &spyWriter{}
+
+		err := recording.NewReplayer(dir, 0, false).Consume(context.Background(), writer)
+
+		Expect(err).To(Equal(ingress.ErrFinished))
+		Expect(writer.origins()).To(Equal([]string{"a", "b", "c"}))
+	},
+		Entry("uncompressed", false, int64(1024*1024)),
+		Entry("gzip compressed", true, int64(1024*1024)),
+		Entry("rotated", false, int64(1)),
+		Entry("rotated and compressed", true, int64(1)),
+	)
+
+	It("replays at the recorded speed", func() {
+		record(false, 1024*1024, 100*time.Millisecond, "a", "b", "c")
+
+		start := time.Now()
+		err := recording.NewReplayer(dir, 1, false).Consume(context.Background(), &spyWriter{})
+
+		Expect(err).To(Equal(ingress.ErrFinished))
+		Expect(time.Since(start)).To(BeNumerically("~", 200*time.Millisecond, 50*time.Millisecond))
+	})
+
+	It("replays at a multiple of the recorded speed", func() {
+		record(false, 1024*1024, 100*time.Millisecond, "a", "b", "c")
+
+		start := time.Now()
+		err := recording.NewReplayer(dir, 4, false).Consume(context.Background(), &spyWriter{})
+
+		Expect(err).To(Equal(ingress.ErrFinished))
+		Expect(time.Since(start)).To(BeNumerically("~", 50*time.Millisecond, 25*time.Millisecond))
+	})
+
+	It("stops when the context is done", func() {
+		record(false, 1024*1024, time.Second, "a", "b")
+		writer := &spyWriter{}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := recording.NewReplayer(dir, 1, false).Consume(ctx, writer)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writer.origins()).To(Equal([]string{"a"}))
+	})
+
+	It("replays the recordings again if it loops", func() {
+		record(false, 1024*1024, 10*time.Millisecond, "a", "b")
+		writer := &spyWriter{}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := recording.NewReplayer(dir, 1, true).Consume(ctx, writer)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(writer.origins())).To(BeNumerically(">", 2))
+		Expect(writer.origins()[:4]).To(Equal([]string{"a", "b", "a", "b"}))
+	})
+
+	It("replays recordings that end with a truncated record", func() {
+		record(false, 1024*1024, 0, "a", "b")
+		files, err := filepath.Glob(filepath.Join(dir, "ouroboros-*.rec"))
+		Expect(err).ToNot(HaveOccurred())
+		info, err := os.Stat(files[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.Truncate(files[0], info.Size()-1)).To(Succeed())
+		writer := &spyWriter{}
+
+		err = recording.NewReplayer(dir, 0, false).Consume(context.Background(), writer)
+
+		Expect(err).To(Equal(ingress.ErrFinished))
+		Expect(writer.origins()).To(Equal([]string{"a"}))
+	})
+
+	It("returns an error when there are no recordings", func() {
+		err := recording.NewReplayer(dir, 0, false).Consume(context.Background(), &spyWriter{})
+
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,33 @@
+package stats
+
+import (
+	"encoding/json"
+	"logging"
+	"net/http"
+)
+
+var logger = logging.New("stats")
+
+// NewHandler serves /health, which always reports ok while the process is
+// up, /stats, which serves a JSON Snapshot, and /metrics, which serves the
+// same stats in the Prometheus format.
+func NewHandler(s *Stats) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Snapshot()); err != nil {
+			logger.With("error", err).Warnf("Failed to encode stats")
+		}
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		s.Metrics().ServeHTTP(w, r)
+	})
+
+	return mux
+}
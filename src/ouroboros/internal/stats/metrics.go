@@ -0,0 +1,42 @@
+package stats
+
+import "metrics"
+
+// Metrics returns the stats in a Registry so they can be served in the
+// Prometheus format. Ingress is broken down by event type and origin like
+// the ingress_breakdown counter ouroboros emits to Loggregator, without an
+// origin label for V2 envelopes.
+func (s *Stats) Metrics() *metrics.Registry {
+	r := metrics.NewRegistry()
+	snap := s.Snapshot()
+
+	r.Add("ouroboros_ingress", nil, snap.Ingress)
+	r.Add("ouroboros_egress", nil, snap.Egress)
+	r.Add("ouroboros_reconnects", nil, snap.Reconnects)
+	if snap.TokenAgeSeconds > 0 {
+		r.Set("ouroboros_token_age_seconds", nil, snap.TokenAgeSeconds)
+	}
+
+	s.mu.Lock()
+	for k, n := range s.breakdown {
+		labels := map[string]string{"event_type": k.eventType}
+		if k.origin != "" {
+			labels["origin"] = k.origin
+		}
+		r.Add("ouroboros_ingress_breakdown", labels, n)
+	}
+	s.mu.Unlock()
+
+	if l := snap.Loop; l != nil {
+		r.Set("ouroboros_loop_received", nil, float64(l.Received))
+		r.Set("ouroboros_loop_lost", nil, float64(l.Lost))
+		r.Set("ouroboros_loop_loss_percent", nil, l.LossPercent)
+		r.Set("ouroboros_loop_duplicates", nil, float64(l.Duplicates))
+		r.Set("ouroboros_loop_reordered", nil, float64(l.Reordered))
+		r.Set("ouroboros_loop_latency_p50_ms", nil, l.LatencyP50)
+		r.Set("ouroboros_loop_latency_p90_ms", nil, l.LatencyP90)
+		r.Set("ouroboros_loop_latency_p99_ms", nil, l.LatencyP99)
+	}
+
+	return r
+}
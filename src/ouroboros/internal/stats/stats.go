@@ -0,0 +1,129 @@
+package stats
+
+import (
+	"ouroboros/internal/loop"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// Stats tracks what ouroboros has done since it started. It is safe for
+// concurrent use.
+type Stats struct {
+	ingress    uint64
+	egress     uint64
+	reconnects uint64
+
+	mu            sync.Mutex
+	breakdown     map[breakdownKey]uint64
+	lastError     string
+	lastErrorTime time.Time
+	tokenTime     time.Time
+	loop          LoopTracker
+}
+
+type breakdownKey struct {
+	eventType string
+	origin    string
+}
+
+type LoopTracker interface {
+	Snapshot() loop.Snapshot
+}
+
+// Snapshot is the JSON view of Stats served on /stats.
+type Snapshot struct {
+	Ingress         uint64            `json:"ingress"`
+	Egress          uint64            `json:"egress"`
+	EventTypes      map[string]uint64 `json:"event_types"`
+	Reconnects      uint64            `json:"reconnects"`
+	LastError       string            `json:"last_error,omitempty"`
+	LastErrorTime   *time.Time        `json:"last_error_time,omitempty"`
+	TokenAgeSeconds float64           `json:"token_age_seconds,omitempty"`
+	Loop            *loop.Snapshot    `json:"loop,omitempty"`
+}
+
+func New() *Stats {
+	return &Stats{
+		breakdown: make(map[breakdownKey]uint64),
+	}
+}
+
+func (s *Stats) recordIngress(e *events.Envelope) {
+	s.recordIngressType(e.GetEventType().String(), e.GetOrigin())
+}
+
+func (s *Stats) recordIngressType(eventType, origin string) {
+	atomic.AddUint64(&s.ingress, 1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakdown[breakdownKey{
+		eventType: eventType,
+		origin:    origin,
+	}]++
+}
+
+func (s *Stats) recordEgress() {
+	atomic.AddUint64(&s.egress, 1)
+}
+
+func (s *Stats) recordReconnect() {
+	atomic.AddUint64(&s.reconnects, 1)
+}
+
+func (s *Stats) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now()
+}
+
+func (s *Stats) recordToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenTime = time.Now()
+}
+
+// TrackLoop includes the loop measurements of the tracker in the stats.
+func (s *Stats) TrackLoop(t LoopTracker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loop = t
+}
+
+// Snapshot returns a copy of the current stats.
+func (s *Stats) Snapshot() Snapshot {
+	snap := Snapshot{
+		Ingress:    atomic.LoadUint64(&s.ingress),
+		Egress:     atomic.LoadUint64(&s.egress),
+		Reconnects: atomic.LoadUint64(&s.reconnects),
+		EventTypes: make(map[string]uint64),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, n := range s.breakdown {
+		snap.EventTypes[k.eventType] += n
+	}
+
+	if s.lastError != "" {
+		t := s.lastErrorTime
+		snap.LastError = s.lastError
+		snap.LastErrorTime = &t
+	}
+
+	if !s.tokenTime.IsZero() {
+		snap.TokenAgeSeconds = time.Since(s.tokenTime).Seconds()
+	}
+
+	if s.loop != nil {
+		l := s.loop.Snapshot()
+		snap.Loop = &l
+	}
+
+	return snap
+}
@@ -0,0 +1,209 @@
+package stats_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"ouroboros/internal/ingress"
+	"ouroboros/internal/loop"
+	"ouroboros/internal/stats"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stats", func() {
+	var (
+		s      *stats.Stats
+		writer *spyEnvelopeWriter
+	)
+
+	BeforeEach(func() {
+		s = stats.New()
+		writer = &spyEnvelopeWriter{}
+	})
+
+	It("counts ingress envelopes by event type", func() {
+		w := stats.NewIngressWriter(s, writer)
+		w.Write(envelope(events.Envelope_LogMessage))
+		w.Write(envelope(events.Envelope_LogMessage))
+		w.Write(envelope(events.Envelope_ValueMetric))
+
+		snap := s.Snapshot()
+		Expect(snap.Ingress).To(Equal(uint64(3)))
+		Expect(snap.EventTypes).To(Equal(map[string]uint64{
+			"LogMessage":  2,
+			"ValueMetric": 1,
+		}))
+		Expect(writer.count).To(Equal(3))
+	})
+
+	It("counts egress envelopes", func() {
+		w := stats.NewEgressWriter(s, writer)
+		w.Write(envelope(events.Envelope_LogMessage))
+
+		Expect(s.Snapshot().Egress).To(Equal(uint64(1)))
+		Expect(writer.count).To(Equal(1))
+	})
+
+	It("counts V2 envelopes as ingress and egress", func() {
+		v2Writer := &spyV2Writer{}
+		w := stats.NewV2Writer(s, v2Writer)
+		w.WriteV2(&loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+		})
+
+		snap := s.Snapshot()
+		Expect(snap.Ingress).To(Equal(uint64(1)))
+		Expect(snap.Egress).To(Equal(uint64(1)))
+		Expect(snap.EventTypes).To(Equal(map[string]uint64{"LogMessage": 1}))
+		Expect(v2Writer.count).To(Equal(1))
+	})
+
+	It("records reconnects and the last error", func() {
+		c := stats.NewConsumer(s, &failingConsumer{})
+		c.Consume(context.Background(), writer)
+		Expect(s.Snapshot().Reconnects).To(BeZero())
+
+		c.Consume(context.Background(), writer)
+		snap := s.Snapshot()
+		Expect(snap.Reconnects).To(Equal(uint64(1)))
+		Expect(snap.LastError).To(Equal("connection lost"))
+		Expect(snap.LastErrorTime).ToNot(BeNil())
+	})
+
+	It("reports the age of the last token", func() {
+		Expect(s.Snapshot().TokenAgeSeconds).To(BeZero())
+
+		token, err := stats.NewTokenFetcher(s, staticTokenFetcher("a-token")).Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("a-token"))
+
+		Eventually(func() float64 {
+			return s.Snapshot().TokenAgeSeconds
+		}).Should(BeNumerically(">", 0))
+	})
+
+	It("includes loop measurements once a tracker is set", func() {
+		Expect(s.Snapshot().Loop).To(BeNil())
+
+		s.TrackLoop(loop.NewTracker("instance", writer))
+		Expect(s.Snapshot().Loop).ToNot(BeNil())
+	})
+
+	Describe("Handler", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(stats.NewHandler(s))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("serves /health", func() {
+			resp, err := http.Get(server.URL + "/health")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("serves /stats as JSON", func() {
+			stats.NewIngressWriter(s, writer).Write(envelope(events.Envelope_LogMessage))
+
+			resp, err := http.Get(server.URL + "/stats")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			var body map[string]interface{}
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body).To(HaveKeyWithValue("ingress", BeNumerically("==", 1)))
+			Expect(body).To(HaveKey("event_types"))
+			Expect(body).ToNot(HaveKey("last_error"))
+		})
+
+		It("serves /metrics in the Prometheus format", func() {
+			w := stats.NewIngressWriter(s, writer)
+			w.Write(envelope(events.Envelope_LogMessage))
+			w.Write(envelope(events.Envelope_LogMessage))
+
+			resp, err := http.Get(server.URL + "/metrics")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(ContainSubstring("ouroboros_ingress 2\n"))
+			Expect(string(body)).To(ContainSubstring(
+				`ouroboros_ingress_breakdown{event_type="LogMessage",origin="some-origin"} 2`,
+			))
+		})
+
+		It("does not label the V2 breakdown by source ID", func() {
+			w := stats.NewV2Writer(s, &spyV2Writer{})
+			for i := 0; i < 100; i++ {
+				w.WriteV2(&loggregator_v2.Envelope{
+					SourceId: fmt.Sprintf("source-%d", i),
+					Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+				})
+			}
+
+			resp, err := http.Get(server.URL + "/metrics")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(body), "ouroboros_ingress_breakdown{")).To(Equal(1))
+			Expect(string(body)).To(ContainSubstring(
+				`ouroboros_ingress_breakdown{event_type="LogMessage"} 100`,
+			))
+		})
+	})
+})
+
+func envelope(t events.Envelope_EventType) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("some-origin"),
+		Timestamp: proto.Int64(99),
+		EventType: t.Enum(),
+	}
+}
+
+type spyEnvelopeWriter struct {
+	count int
+}
+
+func (s *spyEnvelopeWriter) Write(*events.Envelope) {
+	s.count++
+}
+
+type spyV2Writer struct {
+	count int
+}
+
+func (s *spyV2Writer) WriteV2(*loggregator_v2.Envelope) {
+	s.count++
+}
+
+type failingConsumer struct{}
+
+func (failingConsumer) Consume(context.Context, ingress.EnvelopeWriter) error {
+	return errors.New("connection lost")
+}
+
+type staticTokenFetcher string
+
+func (t staticTokenFetcher) Token() (string, error) {
+	return string(t), nil
+}
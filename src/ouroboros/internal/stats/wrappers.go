@@ -0,0 +1,103 @@
+package stats
+
+import (
+	"context"
+	"ouroboros/internal/ingress"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// IngressWriter counts envelopes as they are read from the ingress.
+type IngressWriter struct {
+	stats  *Stats
+	writer ingress.EnvelopeWriter
+}
+
+func NewIngressWriter(s *Stats, w ingress.EnvelopeWriter) *IngressWriter {
+	return &IngressWriter{stats: s, writer: w}
+}
+
+func (w *IngressWriter) Write(e *events.Envelope) {
+	w.stats.recordIngress(e)
+	w.writer.Write(e)
+}
+
+// EgressWriter counts envelopes as they are written to Loggregator.
+type EgressWriter struct {
+	stats  *Stats
+	writer ingress.EnvelopeWriter
+}
+
+func NewEgressWriter(s *Stats, w ingress.EnvelopeWriter) *EgressWriter {
+	return &EgressWriter{stats: s, writer: w}
+}
+
+func (w *EgressWriter) Write(e *events.Envelope) {
+	w.stats.recordEgress()
+	w.writer.Write(e)
+}
+
+// V2Writer counts V2 envelopes that are written straight from the ingress
+// to Loggregator as both ingress and egress. Like the ingress_breakdown
+// counter, they are broken down by event type but not by source ID.
+type V2Writer struct {
+	stats  *Stats
+	writer ingress.V2Writer
+}
+
+func NewV2Writer(s *Stats, w ingress.V2Writer) *V2Writer {
+	return &V2Writer{stats: s, writer: w}
+}
+
+func (w *V2Writer) WriteV2(e *loggregator_v2.Envelope) {
+	w.stats.recordIngressType(ingress.V2EventType(e), "")
+	w.stats.recordEgress()
+	w.writer.WriteV2(e)
+}
+
+// Consumer records the error that ended each ingress connection and counts
+// every connection after the first as a reconnect.
+type Consumer struct {
+	stats     *Stats
+	consumer  ingress.Consumer
+	connected bool
+}
+
+func NewConsumer(s *Stats, c ingress.Consumer) *Consumer {
+	return &Consumer{stats: s, consumer: c}
+}
+
+func (c *Consumer) Consume(ctx context.Context, w ingress.EnvelopeWriter) error {
+	if c.connected {
+		c.stats.recordReconnect()
+	}
+	c.connected = true
+
+	err := c.consumer.Consume(ctx, w)
+	if err != nil && err != ingress.ErrFinished {
+		c.stats.recordError(err)
+	}
+
+	return err
+}
+
+// TokenFetcher records when the last token was fetched successfully.
+type TokenFetcher struct {
+	stats  *Stats
+	tokens ingress.TokenFetcher
+}
+
+func NewTokenFetcher(s *Stats, t ingress.TokenFetcher) *TokenFetcher {
+	return &TokenFetcher{stats: s, tokens: t}
+}
+
+func (f *TokenFetcher) Token() (string, error) {
+	token, err := f.tokens.Token()
+	if err != nil {
+		return "", err
+	}
+
+	f.stats.recordToken()
+	return token, nil
+}
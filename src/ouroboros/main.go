@@ -1,18 +1,36 @@
 package main
 
 import (
+	"conf"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"logging"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
 	"ouroboros/internal/api"
 	"ouroboros/internal/converter"
 	egressv1 "ouroboros/internal/egress/v1"
 	egressv2 "ouroboros/internal/egress/v2"
+	"ouroboros/internal/filter"
+	"ouroboros/internal/generator"
 	"ouroboros/internal/ingress"
+	"ouroboros/internal/loop"
+	"ouroboros/internal/ratelimit"
+	"ouroboros/internal/recording"
+	"ouroboros/internal/stats"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/bradylove/envstruct"
-	"github.com/cloudfoundry-incubator/uaago"
 )
 
 type config struct {
@@ -21,87 +39,574 @@ type config struct {
 	ClientID     string `env:"CLIENT_ID,               required"`
 	ClientSecret string `env:"CLIENT_SECRET,           required"`
 
+	ReconnectBackoff conf.DurationRange `env:"RECONNECT_BACKOFF"`
+
+	IngressSource string   `env:"INGRESS_SOURCE"`
+	RLPAddr       string   `env:"RLP_ADDR"`
+	RLPSelectors  []string `env:"RLP_SELECTORS"`
+	RLPSourceID   string   `env:"RLP_SOURCE_ID"`
+	RLPBatched    bool     `env:"RLP_BATCHED"`
+	RLPTLSCN      string   `env:"RLP_TLS_CN"`
+
+	GeneratorRate           float64       `env:"GENERATOR_RATE"`
+	GeneratorMix            generator.Mix `env:"GENERATOR_MIX"`
+	GeneratorPayloadSize    conf.IntRange `env:"GENERATOR_PAYLOAD_SIZE"`
+	GeneratorAppIDs         int           `env:"GENERATOR_APP_IDS"`
+	GeneratorTags           int           `env:"GENERATOR_TAGS"`
+	GeneratorTagCardinality int           `env:"GENERATOR_TAG_CARDINALITY"`
+
+	ReplayDir   string  `env:"REPLAY_DIR"`
+	ReplaySpeed float64 `env:"REPLAY_SPEED"`
+	ReplayLoop  bool    `env:"REPLAY_LOOP"`
+
+	RecordDir         string `env:"RECORD_DIR"`
+	RecordMaxFileSize int64  `env:"RECORD_MAX_FILE_SIZE"`
+	RecordCompress    bool   `env:"RECORD_COMPRESS"`
+
+	AmplificationMode           string `env:"AMPLIFICATION_MODE"`
+	AmplificationMaxGenerations int    `env:"AMPLIFICATION_MAX_GENERATIONS"`
+
+	FilterEventTypes  []string `env:"FILTER_EVENT_TYPES"`
+	FilterOrigins     []string `env:"FILTER_ORIGINS"`
+	FilterDeployments []string `env:"FILTER_DEPLOYMENTS"`
+	FilterJobs        []string `env:"FILTER_JOBS"`
+	FilterTagName     string   `env:"FILTER_TAG_NAME"`
+	FilterTagPattern  string   `env:"FILTER_TAG_PATTERN"`
+	SamplePercent     float64  `env:"SAMPLE_PERCENT"`
+
+	TransformOrigin string            `env:"TRANSFORM_ORIGIN"`
+	TransformTags   map[string]string `env:"TRANSFORM_TAGS"`
+
+	RateSchedule  ratelimit.Schedule `env:"RATE_SCHEDULE"`
+	RateLimitMode string             `env:"RATE_LIMIT_MODE"`
+
 	LoggregatorEgressAddr     string `env:"LOGGREGATOR_EGRESS_ADDR,     required"`
 	LoggregatorIngressPort    int    `env:"LOGGREGATOR_INGRESS_PORT,    required"`
 	LoggregatorIngressVersion uint8  `env:"LOGGREGATOR_INGRESS_VERSION, required"`
 
+	IngressTransport string `env:"LOGGREGATOR_INGRESS_TRANSPORT"`
+
+	IngressBatchSize     int           `env:"LOGGREGATOR_INGRESS_BATCH_SIZE"`
+	IngressBatchInterval time.Duration `env:"LOGGREGATOR_INGRESS_BATCH_INTERVAL"`
+	IngressStreams       int           `env:"LOGGREGATOR_INGRESS_STREAMS"`
+
 	TLSCACert           string `env:"LOGGREGATOR_TLS_CA_CERT"`
 	TLSClientCert       string `env:"LOGGREGATOR_TLS_CLIENT_CERT"`
 	TLSClientKey        string `env:"LOGGREGATOR_TLS_CLIENT_KEY"`
 	TLSEgressCommonName string `env:"LOGGREGATOR_TLS_EGRESS_CN"`
 
+	HealthPort int `env:"HEALTH_PORT"`
+
+	LogLevel  logging.Level  `env:"LOG_LEVEL"`
+	LogFormat logging.Format `env:"LOG_FORMAT"`
+
+	MetricFlushInterval time.Duration `env:"METRIC_FLUSH_INTERVAL"`
+	LoopMeasurement     bool          `env:"LOOP_MEASUREMENT"`
+
 	DeploymentName string `env:"DEPLOYMENT_NAME, required"`
 	JobName        string `env:"JOB_NAME,        required"`
 	InstanceIndex  string `env:"INSTANCE_INDEX,  required"`
 	InstanceIP     string `env:"INSTANCE_IP,     required"`
 }
 
+var logger = logging.New("ouroboros")
+
 func main() {
-	conf := loadConfig()
-	token := fetchUaaToken(conf)
+	rand.Seed(time.Now().UnixNano())
+	conf, err := loadConfig()
+	if err != nil {
+		logger.With("error", err).Errorf("ouroboros is not happy with your environment")
+		os.Exit(1)
+	}
+	logging.Configure(conf.LogLevel, conf.LogFormat)
 
-	log.Println("Starting ouroboros ingress")
-	ingress.Consume(conf.LoggregatorEgressAddr, conf.SubID, token, buildWriter(conf))
+	if err := run(conf); err != nil {
+		logger.With("error", err).Errorf("ouroboros failed")
+		os.Exit(1)
+	}
 }
 
-func loadConfig() config {
-	var conf config
-	if err := envstruct.Load(&conf); err != nil {
-		log.Fatalf("ouroboros is not happy with your environment: %s", err)
+// run consumes from the ingress and writes to the egress until it receives
+// SIGTERM or SIGINT. It returns an error if ouroboros is misconfigured.
+func run(conf config) error {
+	s := stats.New()
+	if conf.HealthPort != 0 {
+		go serveHealth(conf.HealthPort, s)
 	}
 
-	return conf
-}
+	var instanceID string
+	if conf.LoopMeasurement {
+		instanceID = fmt.Sprintf("%s/%s/%d", conf.JobName, conf.InstanceIndex, time.Now().UnixNano())
+	}
 
-func fetchUaaToken(conf config) string {
-	uaaClient, err := uaago.NewClient(conf.UAAAddr)
+	filters, err := buildFilters(conf)
 	if err != nil {
-		log.Panicf("Error creating uaa client: %s", err)
+		return err
+	}
+	transforms := buildTransforms(conf)
+
+	writer, egress, err := buildWriter(conf, s, instanceID)
+	if err != nil {
+		return err
+	}
+
+	// RLP envelopes are written straight to V2 egress so nothing is lost
+	// converting them to V1 and back.
+	var v2Writer ingress.V2Writer
+	if w, ok := egress.(ingress.V2Writer); ok && conf.IngressSource == "rlp" {
+		if err := checkV2Passthrough(conf, filters, transforms); err != nil {
+			return err
+		}
+		v2Writer = stats.NewV2Writer(s, ingress.NewV2MetricCounter(writer, w))
 	}
 
-	token, err := uaaClient.GetAuthToken(conf.ClientID, conf.ClientSecret, true)
+	consumer, err := buildConsumer(conf, s, v2Writer)
 	if err != nil {
-		log.Panicf("Error getting token from uaa: %s", err)
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+		logger.Infof("Received %s, shutting down", <-sigs)
+		cancel()
+	}()
+
+	var reporting sync.WaitGroup
+	var ingressWriter ingress.EnvelopeWriter = filter.NewChain(writer, transforms, filters...)
+	if instanceID != "" {
+		tracker := loop.NewTracker(instanceID, ingressWriter)
+		s.TrackLoop(tracker)
+		if conf.MetricFlushInterval > 0 {
+			reporting.Add(1)
+			go func() {
+				defer reporting.Done()
+				tracker.ReportEvery(ctx, conf.MetricFlushInterval, writer)
+			}()
+		}
+		ingressWriter = tracker
 	}
 
-	return token
+	var recorder *recording.Recorder
+	if conf.RecordDir != "" {
+		if conf.RecordMaxFileSize <= 0 {
+			return errors.New("RECORD_MAX_FILE_SIZE must be above 0")
+		}
+		recorder = recording.NewRecorder(conf.RecordDir, conf.RecordMaxFileSize, conf.RecordCompress, ingressWriter)
+		ingressWriter = recorder
+	}
+
+	logger.With("source", conf.IngressSource).Infof("Starting ouroboros ingress")
+	ingress.NewSupervisor(
+		stats.NewConsumer(s, consumer),
+		stats.NewIngressWriter(s, ingressWriter),
+		writer,
+		conf.ReconnectBackoff,
+	).Run(ctx)
+
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			logger.With("error", err).Warnf("Failed to close recording")
+		}
+	}
+
+	// The ingress has stopped, so the final counter is emitted before the
+	// egress is flushed and closed.
+	reporting.Wait()
+	writer.Stop()
+	writer.Flush()
+	if err := egress.Close(); err != nil {
+		logger.With("error", err).Warnf("Failed to close egress")
+	}
+	logger.Infof("Ouroboros stopped")
+
+	return nil
 }
 
-func buildWriter(conf config) ingress.EnvelopeWriter {
-	var writer ingress.EnvelopeWriter
+// egressWriter is a writer to Loggregator that must be closed to flush
+// buffered envelopes.
+type egressWriter interface {
+	ingress.EnvelopeWriter
+	io.Closer
+}
+
+func loadConfig() (config, error) {
+	var c config
+	c.ReconnectBackoff = conf.DurationRange{
+		Min: time.Second,
+		Max: time.Minute,
+	}
+	c.IngressSource = "firehose"
+	c.RLPSelectors = []string{"log", "counter", "gauge", "timer"}
+	c.GeneratorRate = 1000
+	c.GeneratorMix = generator.DefaultMix
+	c.GeneratorPayloadSize = conf.IntRange{Min: 10, Max: 1024}
+	c.GeneratorAppIDs = 100
+	c.GeneratorTags = 1
+	c.GeneratorTagCardinality = 10
+	c.ReplaySpeed = 1
+	c.RecordMaxFileSize = 100 * 1024 * 1024
+	c.AmplificationMode = "unbounded"
+	c.AmplificationMaxGenerations = 1
+	c.SamplePercent = 100
+	c.RateLimitMode = "delay"
+	c.IngressTransport = "udp"
+	c.IngressBatchInterval = time.Second
+	c.IngressStreams = 1
+	c.MetricFlushInterval = 10 * time.Second
+	c.LogLevel = logging.Info
+	c.LogFormat = logging.Text
+	if err := envstruct.Load(&c); err != nil {
+		return c, err
+	}
 
-	if conf.LoggregatorIngressVersion == 1 {
-		log.Println("Starting ouroboros V1 egress")
-		writer = egressv1.NewWriter(fmt.Sprintf("localhost:%d", conf.LoggregatorIngressPort))
+	// A backoff starting at 0 never grows, so reconnects would not back off.
+	if b := c.ReconnectBackoff; b.Min <= 0 || b.Min > b.Max {
+		return c, errors.New("RECONNECT_BACKOFF min must be above 0 and at most max")
 	}
 
-	if conf.LoggregatorIngressVersion == 2 {
-		log.Println("Starting ouroboros V2 egress")
+	return c, nil
+}
+
+// buildConsumer creates the consumer for INGRESS_SOURCE: the V1 firehose,
+// the V2 Reverse Log Proxy, the synthetic envelope generator or a replay of
+// recorded envelopes. If a V2 writer is given the Reverse Log Proxy writes
+// to it instead of converting envelopes to V1.
+func buildConsumer(conf config, s *stats.Stats, v2Writer ingress.V2Writer) (ingress.Consumer, error) {
+	switch conf.IngressSource {
+	case "firehose":
+		tokenFetcher, err := ingress.NewUAATokenFetcher(
+			conf.UAAAddr,
+			conf.ClientID,
+			conf.ClientSecret,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating uaa client: %s", err)
+		}
+
+		return ingress.NewFirehoseConsumer(
+			conf.LoggregatorEgressAddr,
+			conf.SubID,
+			stats.NewTokenFetcher(s, tokenFetcher),
+		), nil
+	case "rlp":
+		if conf.RLPAddr == "" {
+			return nil, errors.New("RLP_ADDR is required when INGRESS_SOURCE is rlp")
+		}
 
-		creds := api.NewCredentials(
+		selectors, err := ingress.ParseSelectors(conf.RLPSelectors, conf.RLPSourceID)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid RLP_SELECTORS: %s", err)
+		}
+		if v2Writer == nil {
+			for _, t := range conf.RLPSelectors {
+				if t == "event" {
+					return nil, errors.New("RLP_SELECTORS may only include event with LOGGREGATOR_INGRESS_VERSION 2")
+				}
+			}
+		}
+
+		creds, err := api.NewCredentials(
 			conf.TLSClientCert,
 			conf.TLSClientKey,
 			conf.TLSCACert,
-			conf.TLSEgressCommonName,
+			conf.RLPTLSCN,
 		)
+		if err != nil {
+			return nil, err
+		}
 
-		writer = egressv2.NewWriter(
-			fmt.Sprintf("localhost:%d", conf.LoggregatorIngressPort),
-			converter.NewConverter(false),
+		return ingress.NewRLPConsumer(
+			conf.RLPAddr,
+			conf.SubID,
+			selectors,
+			conf.RLPBatched,
+			v2Writer,
 			grpc.WithTransportCredentials(creds),
+		), nil
+	case "generator":
+		if conf.GeneratorRate <= 0 {
+			return nil, errors.New("GENERATOR_RATE must be above 0")
+		}
+		if conf.GeneratorAppIDs < 1 || conf.GeneratorTagCardinality < 1 {
+			return nil, errors.New("GENERATOR_APP_IDS and GENERATOR_TAG_CARDINALITY must be at least 1")
+		}
+		if conf.GeneratorTags < 0 {
+			return nil, errors.New("GENERATOR_TAGS must not be negative")
+		}
+
+		return generator.New(
+			conf.GeneratorRate,
+			conf.GeneratorMix,
+			conf.GeneratorPayloadSize,
+			conf.GeneratorAppIDs,
+			conf.GeneratorTags,
+			conf.GeneratorTagCardinality,
+		), nil
+	case "replay":
+		if conf.ReplayDir == "" {
+			return nil, errors.New("REPLAY_DIR is required when INGRESS_SOURCE is replay")
+		}
+		if conf.ReplaySpeed < 0 {
+			return nil, errors.New("REPLAY_SPEED must not be negative")
+		}
+
+		return recording.NewReplayer(conf.ReplayDir, conf.ReplaySpeed, conf.ReplayLoop), nil
+	}
+
+	return nil, fmt.Errorf("Invalid INGRESS_SOURCE: %s", conf.IngressSource)
+}
+
+// checkV2Passthrough rejects settings that only apply to V1 envelopes,
+// since RLP envelopes written straight to V2 egress would bypass them.
+func checkV2Passthrough(conf config, filters []filter.Filter, transforms []filter.Transform) error {
+	switch {
+	case len(filters) > 0:
+		return errors.New("FILTER_* and SAMPLE_PERCENT are not supported with INGRESS_SOURCE rlp and V2 egress")
+	case len(transforms) > 0:
+		return errors.New("TRANSFORM_* is not supported with INGRESS_SOURCE rlp and V2 egress")
+	case conf.LoopMeasurement:
+		return errors.New("LOOP_MEASUREMENT is not supported with INGRESS_SOURCE rlp and V2 egress")
+	case conf.RecordDir != "":
+		return errors.New("RECORD_DIR is not supported with INGRESS_SOURCE rlp and V2 egress")
+	case len(conf.RateSchedule) > 0:
+		return errors.New("RATE_SCHEDULE is not supported with INGRESS_SOURCE rlp and V2 egress")
+	case conf.AmplificationMode != "unbounded":
+		return errors.New("AMPLIFICATION_MODE must be unbounded with INGRESS_SOURCE rlp and V2 egress")
+	}
+
+	return nil
+}
+
+// buildWriter creates the egress writer chain. When an instance ID is given
+// envelopes are stamped for loop measurement.
+func buildWriter(conf config, s *stats.Stats, instanceID string) (*ingress.MetricCounter, egressWriter, error) {
+	var (
+		egress egressWriter
+		err    error
+	)
+
+	switch conf.LoggregatorIngressVersion {
+	case 1:
+		logger.With("transport", conf.IngressTransport).Infof("Starting ouroboros V1 egress")
+		egress, err = buildV1Writer(conf)
+	case 2:
+		logger.Infof("Starting ouroboros V2 egress")
+
+		var creds credentials.TransportCredentials
+		creds, err = api.NewCredentials(
+			conf.TLSClientCert,
+			conf.TLSClientKey,
+			conf.TLSCACert,
+			conf.TLSEgressCommonName,
 		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		egress, err = buildV2Writer(conf, grpc.WithTransportCredentials(creds))
+	default:
+		err = errors.New("Invalid LOGGREGATOR_INGRESS_VERSION")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var writer ingress.EnvelopeWriter = stats.NewEgressWriter(s, egress)
+	if instanceID != "" {
+		writer = loop.NewStamper(instanceID, writer)
+	}
+
+	writer, err = limitRate(conf, writer)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if writer == nil {
-		log.Fatal("Invalid LOGGREGATOR_INGRESS_VERSION")
+	writer, err = guardAmplification(conf, writer)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return ingress.NewMetricCounter(
+	counter := ingress.NewMetricCounter(
 		conf.DeploymentName,
 		conf.JobName,
 		conf.InstanceIndex,
 		conf.InstanceIP,
 		1000,
+		conf.MetricFlushInterval,
 		writer,
 	)
+
+	return counter, egress, nil
+}
+
+// serveHealth serves /health and /stats on HEALTH_PORT.
+func serveHealth(port int, s *stats.Stats) {
+	addr := fmt.Sprintf(":%d", port)
+	l := logger.With("addr", addr)
+	l.Infof("Serving health and stats")
+	err := http.ListenAndServe(addr, stats.NewHandler(s))
+	l.With("error", err).Errorf("Health server stopped")
+}
+
+// metronWriteTimeout bounds how long a TCP or TLS write to Metron may block
+// before the connection is dropped and dialed again.
+const metronWriteTimeout = 5 * time.Second
+
+// buildV1Writer creates a writer for the dropsonde transport named by
+// LOGGREGATOR_INGRESS_TRANSPORT: udp, tcp, or tls.
+func buildV1Writer(conf config) (egressWriter, error) {
+	addr := fmt.Sprintf("localhost:%d", conf.LoggregatorIngressPort)
+
+	switch conf.IngressTransport {
+	case "udp":
+		w, err := egressv1.NewWriter(addr)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create UDP writer: %s", err)
+		}
+		return w, nil
+	case "tcp":
+		return egressv1.NewTCPWriter(addr, nil, metronWriteTimeout), nil
+	case "tls":
+		tlsConfig, err := api.NewMutualTLSConfig(
+			conf.TLSClientCert,
+			conf.TLSClientKey,
+			conf.TLSCACert,
+			conf.TLSEgressCommonName,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create mutual TLS config: %s", err)
+		}
+		return egressv1.NewTCPWriter(addr, tlsConfig, metronWriteTimeout), nil
+	}
+
+	return nil, fmt.Errorf("Invalid LOGGREGATOR_INGRESS_TRANSPORT: %s", conf.IngressTransport)
+}
+
+// buildV2Writer creates a single stream writer unless batching is enabled
+// with LOGGREGATOR_INGRESS_BATCH_SIZE, in which case envelopes are batched
+// over LOGGREGATOR_INGRESS_STREAMS streams.
+func buildV2Writer(conf config, creds grpc.DialOption) (egressWriter, error) {
+	addr := fmt.Sprintf("localhost:%d", conf.LoggregatorIngressPort)
+	if conf.IngressBatchSize <= 0 {
+		return egressv2.NewWriter(addr, converter.NewConverter(false), creds)
+	}
+
+	if conf.IngressStreams < 1 {
+		return nil, errors.New("LOGGREGATOR_INGRESS_STREAMS must be at least 1")
+	}
+
+	return egressv2.NewBatchWriter(
+		addr,
+		converter.NewConverter(false),
+		conf.IngressStreams,
+		conf.IngressBatchSize,
+		conf.IngressBatchInterval,
+		conf.ReconnectBackoff,
+		creds,
+	)
+}
+
+// limitRate shapes egress traffic to follow RATE_SCHEDULE. Envelopes over
+// the scheduled rate are delayed or, in drop mode, dropped.
+func limitRate(conf config, w ingress.EnvelopeWriter) (ingress.EnvelopeWriter, error) {
+	if len(conf.RateSchedule) == 0 {
+		return w, nil
+	}
+
+	if conf.RateLimitMode != "delay" && conf.RateLimitMode != "drop" {
+		return nil, fmt.Errorf("Invalid RATE_LIMIT_MODE: %s", conf.RateLimitMode)
+	}
+
+	return ratelimit.NewWriter(
+		conf.RateSchedule,
+		conf.RateLimitMode == "drop",
+		1000,
+		w,
+		ingress.NewCounterEmitter(
+			conf.DeploymentName,
+			conf.JobName,
+			conf.InstanceIndex,
+			conf.InstanceIP,
+			w,
+		),
+	), nil
+}
+
+// guardAmplification bounds how many times an envelope may travel around
+// the loop. In unbounded mode every envelope is re-emitted, in drop mode
+// envelopes ouroboros has already written are dropped, and in bounded mode
+// envelopes are re-emitted up to AMPLIFICATION_MAX_GENERATIONS times.
+func guardAmplification(conf config, w ingress.EnvelopeWriter) (ingress.EnvelopeWriter, error) {
+	switch conf.AmplificationMode {
+	case "unbounded":
+		return w, nil
+	case "drop":
+		return ingress.NewAmplificationGuard(1, w), nil
+	case "bounded":
+		if conf.AmplificationMaxGenerations < 1 {
+			return nil, errors.New("AMPLIFICATION_MAX_GENERATIONS must be at least 1")
+		}
+		return ingress.NewAmplificationGuard(conf.AmplificationMaxGenerations, w), nil
+	}
+
+	return nil, fmt.Errorf("Invalid AMPLIFICATION_MODE: %s", conf.AmplificationMode)
+}
+
+// buildFilters creates the filters that select which firehose envelopes
+// are written back into Loggregator.
+func buildFilters(conf config) ([]filter.Filter, error) {
+	var filters []filter.Filter
+
+	if len(conf.FilterEventTypes) > 0 {
+		types, err := filter.ParseEventTypes(conf.FilterEventTypes)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid FILTER_EVENT_TYPES: %s", err)
+		}
+		filters = append(filters, filter.EventTypes(types...))
+	}
+
+	if len(conf.FilterOrigins) > 0 {
+		filters = append(filters, filter.Origins(conf.FilterOrigins...))
+	}
+
+	if len(conf.FilterDeployments) > 0 {
+		filters = append(filters, filter.Deployments(conf.FilterDeployments...))
+	}
+
+	if len(conf.FilterJobs) > 0 {
+		filters = append(filters, filter.Jobs(conf.FilterJobs...))
+	}
+
+	if conf.FilterTagName != "" {
+		pattern, err := regexp.Compile(conf.FilterTagPattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid FILTER_TAG_PATTERN: %s", err)
+		}
+		filters = append(filters, filter.Tag(conf.FilterTagName, pattern))
+	}
+
+	if conf.SamplePercent < 100 {
+		filters = append(filters, filter.Sample(conf.SamplePercent))
+	}
+
+	return filters, nil
+}
+
+// buildTransforms creates the transforms applied to envelopes that pass the
+// filters before they are written back into Loggregator.
+func buildTransforms(conf config) []filter.Transform {
+	var transforms []filter.Transform
+
+	if conf.TransformOrigin != "" {
+		transforms = append(transforms, filter.SetOrigin(conf.TransformOrigin))
+	}
+
+	if len(conf.TransformTags) > 0 {
+		transforms = append(transforms, filter.AddTags(conf.TransformTags))
+	}
+
+	return transforms
 }
@@ -4,9 +4,11 @@ import (
 	"conf"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"logging"
+	"metrics"
 	"net"
 	"net/http"
+	"os"
 	"syslogr/conns"
 	"syslogr/ranger"
 	"time"
@@ -24,53 +26,87 @@ type Config struct {
 	MetronPort int                `env:"METRON_PORT"`
 	Cert       string             `env:"CERT"`
 	Key        string             `env:"KEY"`
+
+	MetricsPort int `env:"METRICS_PORT"`
+
+	LogLevel  logging.Level  `env:"LOG_LEVEL"`
+	LogFormat logging.Format `env:"LOG_FORMAT"`
 }
 
+var logger = logging.New("syslogr")
+
 func main() {
-	var conf Config
+	conf := Config{
+		LogLevel:  logging.Info,
+		LogFormat: logging.Text,
+	}
 	if err := envstruct.Load(&conf); err != nil {
-		panic(err)
+		fatal("Invalid syslogr config", err)
+	}
+	logging.Configure(conf.LogLevel, conf.LogFormat)
+
+	metronBatcher, err := metricBatcher(conf.MetronPort)
+	if err != nil {
+		fatal("Failed to create metron emitter", err)
 	}
 
-	batcher := metricBatcher(conf.MetronPort)
+	registry := metrics.NewRegistry()
+	batcher := metrics.NewBatcher(metronBatcher, registry)
 	ranger, err := ranger.New(conf.Delay.Min, conf.Delay.Max)
 	if err != nil {
-		panic(err)
+		fatal("Invalid DELAY", err)
 	}
 
-	go serviceSyslog(conf.Port, ranger, batcher)
-	serviceHTTPS(conf.HTTPSPort, conf.Cert, conf.Key, batcher)
+	errs := make(chan error, 3)
+	go func() { errs <- serviceSyslog(conf.Port, ranger, batcher) }()
+	go func() { errs <- serviceHTTPS(conf.HTTPSPort, conf.Cert, conf.Key, batcher) }()
+	if conf.MetricsPort != 0 {
+		go func() { errs <- serviceMetrics(conf.MetricsPort, registry) }()
+	}
+	fatal("syslogr stopped", <-errs)
+}
+
+func fatal(msg string, err error) {
+	logger.With("error", err).Errorf("%s", msg)
+	os.Exit(1)
 }
 
-func metricBatcher(port int) *metricbatcher.MetricBatcher {
+func metricBatcher(port int) (*metricbatcher.MetricBatcher, error) {
 	udpEmitter, err := emitter.NewUdpEmitter(fmt.Sprintf(":%d", port))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	eventEmitter := emitter.NewEventEmitter(udpEmitter, "syslogr")
 	sender := metric_sender.NewMetricSender(eventEmitter)
-	return metricbatcher.New(sender, time.Second)
+	return metricbatcher.New(sender, time.Second), nil
 }
 
-func serviceSyslog(port int, r *ranger.Ranger, b *metricbatcher.MetricBatcher) {
+// serviceSyslog accepts syslog connections until the listener fails.
+// Temporary accept errors are logged and retried.
+func serviceSyslog(port int, r *ranger.Ranger, b conns.MetricBatcher) error {
 	addr := fmt.Sprintf(":%d", port)
-	log.Printf("listening for tcp on: %s", addr)
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer l.Close()
+	logger.With("conn_type", "tcp").With("addr", addr).Infof("listening")
 
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			panic(err)
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				logger.With("conn_type", "tcp").With("error", err).Warnf("accept failed")
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
 		}
 		go conns.Handle(conn, r, b)
 	}
 }
 
-func serviceHTTPS(port int, cert, key string, b *metricbatcher.MetricBatcher) {
+func serviceHTTPS(port int, cert, key string, b conns.MetricBatcher) error {
 	addr := fmt.Sprintf(":%d", port)
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		b.BatchCounter("receivedRequest").
@@ -86,6 +122,13 @@ func serviceHTTPS(port int, cert, key string, b *metricbatcher.MetricBatcher) {
 			Add(uint64(len(d)))
 		w.WriteHeader(http.StatusOK)
 	})
-	log.Printf("listening for https on: %s", addr)
-	log.Fatal(http.ListenAndServeTLS(addr, cert, key, handler))
+	logger.With("conn_type", "https").With("addr", addr).Infof("listening")
+	return http.ListenAndServeTLS(addr, cert, key, handler)
+}
+
+// serviceMetrics serves the syslogr counters in the Prometheus format.
+func serviceMetrics(port int, r *metrics.Registry) error {
+	addr := fmt.Sprintf(":%d", port)
+	logger.With("conn_type", "http").With("addr", addr).Infof("serving metrics")
+	return metrics.ListenAndServe(addr, r)
 }
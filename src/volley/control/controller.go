@@ -0,0 +1,130 @@
+// Package control lets volley's load be changed while it is running.
+package control
+
+import (
+	"conf"
+	"errors"
+	"fmt"
+	"sync"
+
+	"volley/session"
+)
+
+// ErrUnknownPool is returned when scaling a connection type that was never
+// added to the Controller.
+var ErrUnknownPool = errors.New("unknown connection type")
+
+// Controller scales, pauses and resumes named Pools, changes the receive
+// delay shared by their connections and tears down individual sessions.
+type Controller struct {
+	receiveDelay *Delay
+	sessions     *session.Registry
+
+	mu     sync.Mutex
+	pools  map[string]*Pool
+	paused bool
+}
+
+// Status describes every Pool of a Controller.
+type Status struct {
+	Paused       bool                  `json:"paused"`
+	ReceiveDelay string                `json:"receive_delay"`
+	Connections  map[string]PoolStatus `json:"connections"`
+}
+
+func NewController(receiveDelay *Delay, sessions *session.Registry) *Controller {
+	return &Controller{
+		receiveDelay: receiveDelay,
+		sessions:     sessions,
+		pools:        make(map[string]*Pool),
+	}
+}
+
+// Add controls the Pool under the connection type name.
+func (c *Controller) Add(name string, p *Pool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pools[name] = p
+	if c.paused {
+		p.Pause()
+	}
+}
+
+// Scale sets the number of connections of the named type.
+func (c *Controller) Scale(name string, n int) error {
+	if n < 0 {
+		return errors.New("connection count must not be negative")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pools[name]
+	if !ok {
+		return ErrUnknownPool
+	}
+	p.Scale(n)
+
+	return nil
+}
+
+// SetReceiveDelay changes how long connections wait after each envelope.
+func (c *Controller) SetReceiveDelay(r conf.DurationRange) error {
+	if r.Min < 0 || r.Min > r.Max {
+		return errors.New("receive delay must be a non-negative range")
+	}
+	c.receiveDelay.Set(r)
+
+	return nil
+}
+
+// Sessions lists every open connection.
+func (c *Controller) Sessions() []session.Info {
+	return c.sessions.List()
+}
+
+// CloseSession tears down the connection with the session ID. Its Pool
+// reopens it a second later. It returns false if there is no such session.
+func (c *Controller) CloseSession(id uint64) bool {
+	return c.sessions.Close(id)
+}
+
+// Pause closes every connection until Resume is called.
+func (c *Controller) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = true
+	for _, p := range c.pools {
+		p.Pause()
+	}
+}
+
+// Resume reopens every connection closed by Pause.
+func (c *Controller) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = false
+	for _, p := range c.pools {
+		p.Resume()
+	}
+}
+
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := c.receiveDelay.Range()
+	s := Status{
+		Paused:       c.paused,
+		ReceiveDelay: fmt.Sprintf("%s-%s", r.Min, r.Max),
+		Connections:  make(map[string]PoolStatus, len(c.pools)),
+	}
+	for name, p := range c.pools {
+		s.Connections[name] = p.Status()
+	}
+
+	return s
+}
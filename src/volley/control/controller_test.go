@@ -0,0 +1,196 @@
+package control_test
+
+import (
+	"conf"
+	"context"
+	"metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"volley/control"
+	"volley/session"
+
+	"github.com/cloudfoundry/dropsonde/metricbatcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		firehoses    *spyConnections
+		streams      *spyConnections
+		receiveDelay *control.Delay
+		sessions     *session.Registry
+		controller   *control.Controller
+		handler      http.Handler
+	)
+
+	BeforeEach(func() {
+		firehoses = &spyConnections{}
+		streams = &spyConnections{}
+		receiveDelay = control.NewDelay(conf.DurationRange{Min: time.Millisecond, Max: 10 * time.Millisecond})
+
+		sessions = session.NewRegistry(metrics.NewRegistry(), nopBatcher{})
+
+		controller = control.NewController(receiveDelay, sessions)
+		firehosePool := control.NewPool(firehoses.connect)
+		firehosePool.Scale(2)
+		controller.Add("v1_firehose", firehosePool)
+		controller.Add("v1_stream", control.NewPool(streams.connect))
+
+		handler = control.NewHandler(controller, "some-token")
+	})
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://volley"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer some-token")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	It("lists the connections of each type", func() {
+		Eventually(firehoses.Open).Should(Equal(2))
+
+		rw := request(http.MethodGet, "/connections", "")
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{
+			"paused": false,
+			"receive_delay": "1ms-10ms",
+			"connections": {
+				"v1_firehose": {"active": 2, "target": 2},
+				"v1_stream": {"active": 0, "target": 0}
+			}
+		}`))
+	})
+
+	It("scales a connection type", func() {
+		rw := request(http.MethodPut, "/connections/v1_stream", `{"target": 3}`)
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Eventually(streams.Open).Should(Equal(3))
+		Expect(firehoses.Open()).To(Equal(2))
+	})
+
+	It("changes the receive delay", func() {
+		rw := request(http.MethodPut, "/receive_delay", `{"receive_delay": "5ms-6ms"}`)
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(receiveDelay.Range()).To(Equal(conf.DurationRange{
+			Min: 5 * time.Millisecond,
+			Max: 6 * time.Millisecond,
+		}))
+	})
+
+	It("lists open sessions", func() {
+		s := sessions.Open(context.Background(), "v1_stream", "some-app-id")
+		started, err := s.Started.MarshalJSON()
+		Expect(err).ToNot(HaveOccurred())
+
+		rw := request(http.MethodGet, "/sessions", "")
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`[{
+			"id": 1,
+			"type": "v1_stream",
+			"target": "some-app-id",
+			"started": ` + string(started) + `
+		}]`))
+	})
+
+	It("tears down a session", func() {
+		s := sessions.Open(context.Background(), "v1_stream", "some-app-id")
+
+		rw := request(http.MethodDelete, "/sessions/1", "")
+
+		Expect(rw.Code).To(Equal(http.StatusNoContent))
+		Expect(s.Context().Err()).To(HaveOccurred())
+		Expect(sessions.List()).To(BeEmpty())
+	})
+
+	It("pauses and resumes every connection type", func() {
+		request(http.MethodPut, "/connections/v1_stream", `{"target": 1}`)
+		Eventually(streams.Open).Should(Equal(1))
+		Eventually(firehoses.Open).Should(Equal(2))
+
+		rw := request(http.MethodPost, "/pause", "")
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Eventually(streams.Open).Should(Equal(0))
+		Eventually(firehoses.Open).Should(Equal(0))
+		Expect(controller.Status().Paused).To(BeTrue())
+
+		rw = request(http.MethodPost, "/resume", "")
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Eventually(streams.Open).Should(Equal(1))
+		Eventually(firehoses.Open).Should(Equal(2))
+	})
+
+	It("pauses connection types added while paused", func() {
+		controller.Pause()
+		conns := &spyConnections{}
+		pool := control.NewPool(conns.connect)
+		controller.Add("v2_firehose", pool)
+
+		Expect(controller.Scale("v2_firehose", 2)).To(Succeed())
+		Consistently(conns.Open).Should(Equal(0))
+	})
+
+	DescribeTable("rejects bad requests", func(method, path, body string, status int) {
+		rw := request(method, path, body)
+		Expect(rw.Code).To(Equal(status))
+	},
+		Entry("unknown type", http.MethodPut, "/connections/unknown", `{"target": 1}`, http.StatusNotFound),
+		Entry("missing target", http.MethodPut, "/connections/v1_stream", `{}`, http.StatusBadRequest),
+		Entry("negative target", http.MethodPut, "/connections/v1_stream", `{"target": -1}`, http.StatusBadRequest),
+		Entry("invalid receive delay", http.MethodPut, "/receive_delay", `{"receive_delay": "soon"}`, http.StatusBadRequest),
+		Entry("reversed receive delay", http.MethodPut, "/receive_delay", `{"receive_delay": "2s-1s"}`, http.StatusBadRequest),
+		Entry("wrong method", http.MethodGet, "/pause", "", http.StatusMethodNotAllowed),
+		Entry("unknown session", http.MethodDelete, "/sessions/42", "", http.StatusNotFound),
+		Entry("invalid session ID", http.MethodDelete, "/sessions/first", "", http.StatusBadRequest),
+	)
+
+	DescribeTable("rejects requests without the token", func(header string) {
+		req := httptest.NewRequest(http.MethodGet, "http://volley/connections", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+	},
+		Entry("no header", ""),
+		Entry("wrong token", "Bearer other-token"),
+		Entry("token without the bearer scheme", "some-token"),
+	)
+
+	It("rejects every request when no token is configured", func() {
+		handler = control.NewHandler(controller, "")
+		req := httptest.NewRequest(http.MethodGet, "http://volley/connections", nil)
+		req.Header.Set("Authorization", "Bearer ")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+	})
+})
+
+type nopBatcher struct{}
+
+func (nopBatcher) BatchCounter(string) metricbatcher.BatchCounterChainer {
+	return nopChainer{}
+}
+
+type nopChainer struct{}
+
+func (c nopChainer) SetTag(string, string) metricbatcher.BatchCounterChainer {
+	return c
+}
+
+func (nopChainer) Increment() {}
+func (nopChainer) Add(uint64) {}
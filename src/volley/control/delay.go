@@ -0,0 +1,46 @@
+package control
+
+import (
+	"conf"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Delay is a range of durations that can be changed while connections are
+// reading with it. It is safe for concurrent use.
+type Delay struct {
+	mu sync.RWMutex
+	r  conf.DurationRange
+}
+
+func NewDelay(r conf.DurationRange) *Delay {
+	return &Delay{r: r}
+}
+
+// Set changes the range.
+func (d *Delay) Set(r conf.DurationRange) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.r = r
+}
+
+// Range returns the current range.
+func (d *Delay) Range() conf.DurationRange {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.r
+}
+
+// Duration returns a random duration within the current range.
+func (d *Delay) Duration() time.Duration {
+	r := d.Range()
+	delta := r.Max - r.Min
+	if delta <= 0 {
+		return r.Min
+	}
+
+	return r.Min + time.Duration(rand.Int63n(int64(delta)))
+}
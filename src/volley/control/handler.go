@@ -0,0 +1,177 @@
+package control
+
+import (
+	"conf"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NewHandler serves the control API for the Controller. Every request must
+// carry the token as "Authorization: Bearer <token>".
+//
+//	GET    /connections         status of every connection type
+//	PUT    /connections/<type>  {"target": 10} scales a connection type
+//	GET    /sessions            every open connection
+//	DELETE /sessions/<id>       tears down a connection
+//	PUT    /receive_delay       {"receive_delay": "1ms-10ms"}
+//	POST   /pause               closes every connection
+//	POST   /resume              reopens every connection
+func NewHandler(c *Controller, token string) http.Handler {
+	h := &handler{
+		controller: c,
+		token:      token,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connections", h.connections)
+	mux.HandleFunc("/connections/", h.scale)
+	mux.HandleFunc("/sessions", h.sessions)
+	mux.HandleFunc("/sessions/", h.closeSession)
+	mux.HandleFunc("/receive_delay", h.setReceiveDelay)
+	mux.HandleFunc("/pause", h.pause)
+	mux.HandleFunc("/resume", h.resume)
+
+	return h.authenticate(mux)
+}
+
+type handler struct {
+	controller *Controller
+	token      string
+}
+
+func (h *handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(auth, "Bearer ")
+		if h.token == "" ||
+			given == auth ||
+			subtle.ConstantTimeCompare([]byte(given), []byte(h.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) connections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.writeStatus(w)
+}
+
+func (h *handler) scale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Target *int `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Target == nil {
+		http.Error(w, `expected {"target": <count>}`, http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/connections/")
+	switch err := h.controller.Scale(name, *body.Target); err {
+	case nil:
+	case ErrUnknownPool:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeStatus(w)
+}
+
+func (h *handler) sessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.controller.Sessions())
+}
+
+func (h *handler) closeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/sessions/"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if !h.controller.CloseSession(id) {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) setReceiveDelay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		ReceiveDelay string `json:"receive_delay"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `expected {"receive_delay": "<min>-<max>"}`, http.StatusBadRequest)
+		return
+	}
+
+	var d conf.DurationRange
+	if err := d.UnmarshalEnv(body.ReceiveDelay); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.controller.SetReceiveDelay(d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeStatus(w)
+}
+
+func (h *handler) pause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.controller.Pause()
+	h.writeStatus(w)
+}
+
+func (h *handler) resume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.controller.Resume()
+	h.writeStatus(w)
+}
+
+func (h *handler) writeStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.controller.Status())
+}
@@ -0,0 +1,114 @@
+package control
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pool keeps a target number of connections open. Each connection is a
+// call to connect that should return once its context is done. Connections
+// that end on their own, e.g. because their session was closed, are
+// reopened after a second.
+type Pool struct {
+	connect func(ctx context.Context)
+
+	mu      sync.Mutex
+	target  int
+	paused  bool
+	active  int
+	cancels []context.CancelFunc
+}
+
+// PoolStatus is the number of connections a Pool should have open and the
+// number it has open, not counting those waiting to be reopened.
+type PoolStatus struct {
+	Active int `json:"active"`
+	Target int `json:"target"`
+}
+
+func NewPool(connect func(ctx context.Context)) *Pool {
+	return &Pool{
+		connect: connect,
+	}
+}
+
+// Scale opens or closes connections until n are open.
+func (p *Pool) Scale(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.target = n
+	p.reconcile()
+}
+
+// Pause closes every connection until Resume is called. The target is
+// kept, so scaling a paused Pool takes effect once it is resumed.
+func (p *Pool) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = true
+	p.reconcile()
+}
+
+// Resume reopens the connections closed by Pause.
+func (p *Pool) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = false
+	p.reconcile()
+}
+
+func (p *Pool) Status() PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolStatus{
+		Active: p.active,
+		Target: p.target,
+	}
+}
+
+func (p *Pool) reconcile() {
+	want := p.target
+	if p.paused {
+		want = 0
+	}
+
+	for len(p.cancels) < want {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancels = append(p.cancels, cancel)
+		p.active++
+		go p.run(ctx)
+	}
+
+	for len(p.cancels) > want {
+		last := len(p.cancels) - 1
+		p.cancels[last]()
+		p.cancels = p.cancels[:last]
+	}
+}
+
+func (p *Pool) run(ctx context.Context) {
+	for {
+		p.connect(ctx)
+		p.addActive(-1)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+
+		p.addActive(1)
+	}
+}
+
+func (p *Pool) addActive(delta int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active += delta
+}
@@ -0,0 +1,119 @@
+package control_test
+
+import (
+	"conf"
+	"context"
+	"sync"
+	"time"
+
+	"volley/control"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pool", func() {
+	var (
+		conns *spyConnections
+		pool  *control.Pool
+	)
+
+	BeforeEach(func() {
+		conns = &spyConnections{}
+		pool = control.NewPool(conns.connect)
+	})
+
+	It("opens connections up to the target", func() {
+		pool.Scale(3)
+
+		Eventually(conns.Open).Should(Equal(3))
+		Expect(pool.Status()).To(Equal(control.PoolStatus{Active: 3, Target: 3}))
+	})
+
+	It("closes connections when scaled down", func() {
+		pool.Scale(5)
+		Eventually(conns.Open).Should(Equal(5))
+
+		pool.Scale(2)
+
+		Eventually(conns.Open).Should(Equal(2))
+		Eventually(pool.Status).Should(Equal(control.PoolStatus{Active: 2, Target: 2}))
+	})
+
+	It("closes every connection while paused", func() {
+		pool.Scale(3)
+		Eventually(conns.Open).Should(Equal(3))
+
+		pool.Pause()
+		Eventually(conns.Open).Should(Equal(0))
+
+		pool.Scale(4)
+		Consistently(conns.Open).Should(Equal(0))
+		Expect(pool.Status().Target).To(Equal(4))
+
+		pool.Resume()
+		Eventually(conns.Open).Should(Equal(4))
+	})
+
+	It("reopens connections that end on their own", func() {
+		var (
+			mu    sync.Mutex
+			calls int
+		)
+		pool = control.NewPool(func(context.Context) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+		})
+		pool.Scale(1)
+
+		Eventually(pool.Status).Should(Equal(control.PoolStatus{Active: 0, Target: 1}))
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return calls
+		}, 3).Should(BeNumerically(">=", 2))
+	})
+})
+
+var _ = Describe("Delay", func() {
+	It("returns durations within the current range", func() {
+		d := control.NewDelay(conf.DurationRange{Min: time.Millisecond, Max: 2 * time.Millisecond})
+		for i := 0; i < 100; i++ {
+			Expect(d.Duration()).To(BeNumerically("~", 1500*time.Microsecond, 500*time.Microsecond))
+		}
+
+		d.Set(conf.DurationRange{Min: time.Second, Max: time.Second})
+		Expect(d.Duration()).To(Equal(time.Second))
+		Expect(d.Range()).To(Equal(conf.DurationRange{Min: time.Second, Max: time.Second}))
+	})
+
+	It("returns no delay for an empty range", func() {
+		d := control.NewDelay(conf.DurationRange{})
+		Expect(d.Duration()).To(BeZero())
+	})
+})
+
+type spyConnections struct {
+	mu   sync.Mutex
+	open int
+}
+
+func (s *spyConnections) connect(ctx context.Context) {
+	s.mu.Lock()
+	s.open++
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	s.open--
+	s.mu.Unlock()
+}
+
+func (s *spyConnections) Open() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.open
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"conf"
 	"fmt"
-	"log"
+	"logging"
 	"math/rand"
+	prom "metrics"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -21,25 +22,72 @@ import (
 	"github.com/cloudfoundry/dropsonde/metricbatcher"
 	"github.com/cloudfoundry/dropsonde/metrics"
 
+	"volley/control"
+	"volley/profile"
+	"volley/scenario"
+	"volley/session"
+	"volley/shard"
 	"volley/syslogdrain"
 	"volley/v1"
 	"volley/v2"
+	"volley/validate"
 )
 
+var logger = logging.New("volley")
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
-	log.Println("Volley started...")
-	defer log.Println("Volley closing")
 	config, err := LoadConfig()
 	if err != nil {
-		log.Panic(err)
+		logger.With("error", err).Errorf("Invalid volley config")
+		os.Exit(1)
+	}
+	logging.Configure(config.LogLevel, config.LogFormat)
+	if config.AppIDFile != "" && config.AppIDSaveInterval <= 0 {
+		logger.With("interval", config.AppIDSaveInterval).Errorf("APP_ID_SAVE_INTERVAL must be positive")
+		os.Exit(1)
+	}
+	if config.V2SourcesPerRequest < 1 {
+		logger.With("sources", config.V2SourcesPerRequest).Errorf("V2_SOURCES_PER_REQUEST must be positive")
+		os.Exit(1)
+	}
+	if config.BatchedReceiverRatio < 0 || config.BatchedReceiverRatio > 1 {
+		logger.With("ratio", config.BatchedReceiverRatio).Errorf("BATCHED_RECEIVER_RATIO must be between 0 and 1")
+		os.Exit(1)
+	}
+
+	phases, err := loadPhases(config)
+	if err != nil {
+		logger.With("file", config.ScenarioFile).With("error", err).Errorf("Invalid scenario")
+		os.Exit(1)
+	}
+
+	logger.Infof("Volley started...")
+	defer logger.Infof("Volley closing")
+	shards, err := shard.NewGroups(config.SubscriptionID, config.ShardGroupWeights)
+	if err != nil {
+		logger.With("error", err).Errorf("Invalid SHARD_GROUP_WEIGHTS")
+		os.Exit(1)
+	}
+	logger.With("shard_ids", shards.IDs()).Infof("Spreading firehoses across shard groups")
+
+	idStoreLen := idStoreSize(phases, config.V2SourcesPerRequest, config.AppIDPoolSize)
+	dist, err := buildDistribution(config, idStoreLen)
+	if err != nil {
+		logger.With("error", err).Errorf("Invalid app ID distribution")
+		os.Exit(1)
+	}
+	idStore := v1.NewIDStore(idStoreLen, config.AppIDGetTimeout, dist)
+	seedIDs(config, idStore, idStoreLen)
+	if config.AppIDFile != "" {
+		go saveIDs(config.AppIDFile, config.AppIDSaveInterval, idStore)
 	}
-	idStore := v1.NewIDStore(config.StreamCount)
 
 	udpEmitter, err := emitter.NewUdpEmitter(fmt.Sprintf("127.0.0.1:%d", config.MetronPort))
 	if err != nil {
-		log.Panic(err)
+		logger.With("error", err).Errorf("Failed to create metron emitter")
+		os.Exit(1)
 	}
 	eventEmitter := emitter.NewEventEmitter(udpEmitter, "volley")
 
@@ -47,6 +95,12 @@ func main() {
 	metricBatcher := metricbatcher.New(metricSender, config.MetricBatchInterval)
 	metrics.Initialize(metricSender, metricBatcher)
 
+	registry := prom.NewRegistry()
+	batcher := prom.NewBatcher(metricBatcher, registry)
+	if config.MetricsPort != 0 {
+		go serveMetrics(config.MetricsPort, registry)
+	}
+
 	cupsTLS, err := tls.NewMutualTLSConfig(
 		config.CUPSServerCert,
 		config.CUPSServerKey,
@@ -54,30 +108,47 @@ func main() {
 		config.CUPSServerCN,
 	)
 	if err != nil {
-		log.Printf("Failed to load CUPS TLS config: %s", err)
+		logger.With("error", err).Warnf("Failed to load CUPS TLS config")
 	}
 
-	go syslogdrain.ListenAndServe(
-		cupsTLS,
-		config.CUPSPort,
-		idStore,
-		config.SyslogDrainURLs,
-		config.SyslogDrains,
-	)
+	go func() {
+		err := syslogdrain.ListenAndServe(
+			cupsTLS,
+			config.CUPSPort,
+			idStore,
+			config.SyslogDrainURLs,
+			phases,
+		)
+		logger.With("port", config.CUPSPort).With("error", err).Errorf("CUPS provider stopped")
+	}()
+
+	receiveDelay := control.NewDelay(phases[0].ReceiveDelay)
+	consumerProfile, err := buildProfile(config, receiveDelay)
+	if err != nil {
+		logger.With("error", err).Errorf("Invalid consumer profile")
+		os.Exit(1)
+	}
+	sessions := session.NewRegistry(registry, batcher)
+	var validator *validate.Validator
+	if config.ValidateEnvelopes {
+		validator = validate.NewValidator(batcher, config.ValidationLogEvery)
+	}
+	controller := control.NewController(receiveDelay, sessions)
 
 	egressV1 := v1.NewEgressV1(
-		config.FirehoseCount,
-		config.StreamCount,
-		config.RecentLogCount,
-		config.ContainerMetricCount,
+		phases,
 		config.TCAddresses,
 		config.AuthToken,
-		config.SubscriptionID,
-		config.ReceiveDelay,
-		config.AsyncRequestDelay,
+		shards,
+		receiveDelay,
+		consumerProfile,
 		idStore,
-		metricBatcher,
+		batcher,
+		validator,
+		sessions,
+		config.ContinuousRequests,
 	)
+	addPools(controller, egressV1.Pools())
 	go egressV1.Start()
 
 	if len(config.RLPAddresses) > 0 {
@@ -88,31 +159,46 @@ func main() {
 			"reverselogproxy",
 		)
 		if err != nil {
-			log.Panic(err)
+			logger.With("error", err).Errorf("Failed to load RLP TLS config")
+			os.Exit(1)
 		}
 
 		v2ConnManager := v2.NewConnectionManager(
 			config.RLPAddresses,
-			config.ReceiveDelay,
+			consumerProfile,
 			config.UsePreferredTags,
-			metricBatcher,
+			config.BatchedReceiverRatio,
+			batcher,
+			validator,
+			sessions,
 			grpc.WithTransportCredentials(credentials.NewTLS(rlpTLSConfig)),
 		)
 		egressV2 := v2.NewEgressV2(
 			v2ConnManager,
 			idStore,
-			config.FirehoseCount,
-			config.StreamCount,
-			config.StreamCount,
+			shards,
+			receiveDelay,
+			config.V2CounterName,
+			config.V2GaugeNames,
+			config.V2SourcesPerRequest,
+			phases,
 		)
+		addPools(controller, egressV2.Pools())
 		go egressV2.Start()
 	}
 
+	if config.ControlPort != 0 {
+		go serveControl(config.ControlPort, config.ControlToken, config.CUPSServerCert, config.CUPSServerKey, controller)
+	}
+
 	killer := NewKiller(
 		config.KillDelay,
 		func() {
+			if config.AppIDFile != "" {
+				writeIDs(config.AppIDFile, idStore)
+			}
 			if err := syscall.Kill(os.Getpid(), syscall.SIGKILL); err != nil {
-				log.Fatalf("I HAVE TOO MUCH TO LIVE FOR: %s!!!!", err)
+				logger.With("error", err).Errorf("I HAVE TOO MUCH TO LIVE FOR!!!!")
 			}
 		},
 	)
@@ -121,7 +207,7 @@ func main() {
 	if len(config.SyslogDrainURLs) > 0 {
 		syslogRegistrar := syslogdrain.NewSyslogRegistrar(
 			config.SyslogTTL,
-			config.SyslogDrains,
+			phases,
 			config.SyslogDrainURLs,
 			config.ETCDAddresses,
 			idStore,
@@ -131,7 +217,7 @@ func main() {
 
 	// Blocking on pprof
 	if err := http.ListenAndServe("localhost:0", nil); err != nil {
-		log.Printf("Error starting pprof server: %s", err)
+		logger.With("error", err).Errorf("Error starting pprof server")
 	}
 }
 
@@ -150,13 +236,47 @@ type Config struct {
 	SyslogDrains         int                `env:"SYSLOG_DRAINS"`
 	SyslogTTL            time.Duration      `env:"SYSLOG_TTL"`
 	SubscriptionID       string             `env:"SUB_ID"`
+	ShardGroupWeights    []int              `env:"SHARD_GROUP_WEIGHTS"`
 	ReceiveDelay         conf.DurationRange `env:"RECV_DELAY"`
 	AsyncRequestDelay    conf.DurationRange `env:"ASYNC_REQUEST_DELAY"`
+	ContinuousRequests   bool               `env:"CONTINUOUS_REQUESTS"`
 	KillDelay            conf.DurationRange `env:"KILL_DELAY"`
+	AppIDFile            string             `env:"APP_ID_FILE"`
+	AppIDSaveInterval    time.Duration      `env:"APP_ID_SAVE_INTERVAL"`
+	AppIDSeedURL         string             `env:"APP_ID_SEED_URL"`
+	AppIDGetTimeout      time.Duration      `env:"APP_ID_GET_TIMEOUT"`
+	AppIDPoolSize        int                `env:"APP_ID_POOL_SIZE"`
+	AppIDDistribution    string             `env:"APP_ID_DISTRIBUTION"`
+	ZipfExponent         float64            `env:"ZIPF_EXPONENT"`
+	HotAppCount          int                `env:"HOT_APP_COUNT"`
+	HotAppFraction       float64            `env:"HOT_APP_FRACTION"`
 	UsePreferredTags     bool               `env:"USE_PREFERRED_TAGS"`
+	BatchedReceiverRatio float64            `env:"BATCHED_RECEIVER_RATIO"`
+	V2CounterStreams     int                `env:"V2_COUNTER_STREAM_COUNT"`
+	V2GaugeStreams       int                `env:"V2_GAUGE_STREAM_COUNT"`
+	V2TimerStreams       int                `env:"V2_TIMER_STREAM_COUNT"`
+	V2EventStreams       int                `env:"V2_EVENT_STREAM_COUNT"`
+	V2MultiSourceStreams int                `env:"V2_MULTI_SOURCE_STREAM_COUNT"`
+	V2CounterName        string             `env:"V2_COUNTER_NAME"`
+	V2GaugeNames         []string           `env:"V2_GAUGE_NAMES"`
+	V2SourcesPerRequest  int                `env:"V2_SOURCES_PER_REQUEST"`
+	ValidateEnvelopes    bool               `env:"VALIDATE_ENVELOPES"`
+	ValidationLogEvery   int                `env:"VALIDATION_LOG_EVERY"`
 	TLSCertPath          string             `env:"V2_TLS_CERT_PATH"`
 	TLSKeyPath           string             `env:"V2_TLS_KEY_PATH"`
 	TLSCAPath            string             `env:"V2_TLS_CA_PATH"`
+	MetricsPort          int                `env:"METRICS_PORT"`
+	ScenarioFile         string             `env:"SCENARIO_FILE"`
+	ControlPort          int                `env:"CONTROL_PORT"`
+	ControlToken         string             `env:"CONTROL_TOKEN"`
+	ConsumerProfile      string             `env:"CONSUMER_PROFILE"`
+	BurstReadDuration    time.Duration      `env:"BURST_READ_DURATION"`
+	BurstStallDuration   time.Duration      `env:"BURST_STALL_DURATION"`
+	StallAfter           time.Duration      `env:"STALL_AFTER"`
+	BandwidthLimit       int                `env:"BANDWIDTH_BYTES_PER_SECOND"`
+	HalfCloseAfter       time.Duration      `env:"HALF_CLOSE_AFTER"`
+	LogLevel             logging.Level      `env:"LOG_LEVEL"`
+	LogFormat            logging.Format     `env:"LOG_FORMAT"`
 
 	CUPSPort       int16  `env:"CUPS_PORT,        required"`
 	CUPSServerCert string `env:"CUPS_SERVER_CERT, required"`
@@ -168,10 +288,208 @@ type Config struct {
 func LoadConfig() (Config, error) {
 	var c Config
 	c.MetricBatchInterval = 5 * time.Second
+	c.ConsumerProfile = "uniform"
+	c.BurstReadDuration = 5 * time.Second
+	c.BurstStallDuration = 10 * time.Second
+	c.StallAfter = 10 * time.Second
+	c.BandwidthLimit = 1024 * 1024
+	c.HalfCloseAfter = 30 * time.Second
+	c.ValidationLogEvery = 100
+	c.V2SourcesPerRequest = 3
+	c.AppIDSaveInterval = 30 * time.Second
+	c.AppIDGetTimeout = 30 * time.Second
+	c.AppIDDistribution = "uniform"
+	c.ZipfExponent = 1
+	c.HotAppCount = 10
+	c.HotAppFraction = 0.8
+	c.LogLevel = logging.Info
+	c.LogFormat = logging.Text
 	err := envstruct.Load(&c)
 	return c, err
 }
 
+// loadPhases reads the phases from SCENARIO_FILE. Without a scenario file
+// volley runs a single endless phase using the connection counts and delays
+// from its environment.
+func loadPhases(c Config) ([]scenario.Phase, error) {
+	if c.ScenarioFile != "" {
+		return scenario.Load(c.ScenarioFile)
+	}
+
+	p := scenario.Phase{
+		Name: "default",
+		V1: scenario.V1Mix{
+			Firehose:         c.FirehoseCount,
+			Stream:           c.StreamCount,
+			RecentLogs:       c.RecentLogCount,
+			ContainerMetrics: c.ContainerMetricCount,
+		},
+		V2: scenario.V2Mix{
+			Firehose:          c.FirehoseCount,
+			AppStream:         c.StreamCount,
+			AppLogStream:      c.StreamCount,
+			CounterStream:     c.V2CounterStreams,
+			GaugeStream:       c.V2GaugeStreams,
+			TimerStream:       c.V2TimerStreams,
+			EventStream:       c.V2EventStreams,
+			MultiSourceStream: c.V2MultiSourceStreams,
+		},
+		ReceiveDelay:      c.ReceiveDelay,
+		AsyncRequestDelay: c.AsyncRequestDelay,
+		SyslogDrains:      c.SyslogDrains,
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return []scenario.Phase{p}, nil
+}
+
+// idStoreSize is APP_ID_POOL_SIZE, raised to the largest number of app
+// streams of any phase so that every stream, and every source of a
+// multi-source stream, can be given its own app ID.
+func idStoreSize(phases []scenario.Phase, sourcesPerRequest, poolSize int) int {
+	size := 1
+	if poolSize > size {
+		size = poolSize
+	}
+	for _, p := range phases {
+		for _, n := range []int{p.V1.Stream, p.V2.AppStream, p.V2.AppLogStream, p.V2.MultiSourceStream * sourcesPerRequest} {
+			if n > size {
+				size = n
+			}
+		}
+	}
+
+	return size
+}
+
+// seedIDs fills the store with the app IDs saved by a previous run in
+// APP_ID_FILE and those listed by APP_ID_SEED_URL, so that streams and
+// requests do not have to wait for the firehose to see enough apps.
+func seedIDs(c Config, s *v1.IDStore, limit int) {
+	if c.AppIDFile != "" {
+		ids, err := v1.ReadIDFile(c.AppIDFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			logger.With("file", c.AppIDFile).With("error", err).Warnf("Unable to read saved app IDs")
+		default:
+			s.Seed(ids)
+			logger.With("file", c.AppIDFile).With("count", len(ids)).Infof("Seeded saved app IDs")
+		}
+	}
+
+	if c.AppIDSeedURL != "" {
+		ids, err := v1.FetchAppIDs(c.AppIDSeedURL, c.AuthToken, limit)
+		s.Seed(ids)
+
+		l := logger.With("url", c.AppIDSeedURL).With("count", len(ids))
+		switch {
+		case err != nil && len(ids) == 0:
+			l.With("error", err).Warnf("Unable to seed listed app IDs")
+		case err != nil:
+			l.With("error", err).Warnf("Partially seeded listed app IDs")
+		default:
+			l.Infof("Seeded listed app IDs")
+		}
+	}
+}
+
+// saveIDs writes the stored app IDs to the file every interval, so that
+// they survive volley being killed.
+func saveIDs(path string, interval time.Duration, s *v1.IDStore) {
+	for range time.Tick(interval) {
+		writeIDs(path, s)
+	}
+}
+
+func writeIDs(path string, s *v1.IDStore) {
+	if err := v1.WriteIDFile(path, s.IDs()); err != nil {
+		logger.With("file", path).With("error", err).Warnf("Unable to save app IDs")
+	}
+}
+
+// serveMetrics serves the volley counters in the Prometheus format on
+// METRICS_PORT.
+func serveMetrics(port int, r *prom.Registry) {
+	addr := fmt.Sprintf(":%d", port)
+	logger.With("addr", addr).Infof("Serving metrics")
+	err := prom.ListenAndServe(addr, r)
+	logger.With("addr", addr).With("error", err).Errorf("Metrics server stopped")
+}
+
+// buildProfile returns how every V1 and V2 connection reads envelopes. Only
+// the uniform profile uses the receive delay.
+func buildProfile(c Config, receiveDelay *control.Delay) (profile.Profile, error) {
+	switch c.ConsumerProfile {
+	case "uniform":
+		return profile.NewUniform(receiveDelay), nil
+	case "bursty":
+		return profile.NewBursty(c.BurstReadDuration, c.BurstStallDuration), nil
+	case "stalled":
+		return profile.NewStalled(c.StallAfter), nil
+	case "bandwidth":
+		if c.BandwidthLimit <= 0 {
+			return nil, fmt.Errorf("BANDWIDTH_BYTES_PER_SECOND must be positive")
+		}
+		return profile.NewBandwidth(c.BandwidthLimit), nil
+	case "half_close":
+		return profile.NewHalfClose(c.HalfCloseAfter), nil
+	default:
+		return nil, fmt.Errorf("unknown CONSUMER_PROFILE %q", c.ConsumerProfile)
+	}
+}
+
+// buildDistribution returns how app streams, recent logs and container
+// metrics requests and syslog drains pick their apps from a pool of
+// poolSize app IDs.
+func buildDistribution(c Config, poolSize int) (v1.Distribution, error) {
+	switch c.AppIDDistribution {
+	case "uniform":
+		return v1.NewUniform(), nil
+	case "zipf":
+		if c.ZipfExponent <= 0 {
+			return nil, fmt.Errorf("ZIPF_EXPONENT must be positive")
+		}
+		return v1.NewZipf(c.ZipfExponent), nil
+	case "hot":
+		if c.HotAppCount < 1 {
+			return nil, fmt.Errorf("HOT_APP_COUNT must be positive")
+		}
+		if c.HotAppCount >= poolSize {
+			return nil, fmt.Errorf("HOT_APP_COUNT must be smaller than the app ID pool size of %d, see APP_ID_POOL_SIZE", poolSize)
+		}
+		if c.HotAppFraction < 0 || c.HotAppFraction > 1 {
+			return nil, fmt.Errorf("HOT_APP_FRACTION must be between 0 and 1")
+		}
+		return v1.NewHotSet(c.HotAppCount, c.HotAppFraction), nil
+	default:
+		return nil, fmt.Errorf("unknown APP_ID_DISTRIBUTION %q", c.AppIDDistribution)
+	}
+}
+
+func addPools(c *control.Controller, pools map[string]*control.Pool) {
+	for name, p := range pools {
+		c.Add(name, p)
+	}
+}
+
+// serveControl serves the control API over TLS on CONTROL_PORT, with the
+// CUPS server certificate so the token is never sent in the clear. Requests
+// must carry CONTROL_TOKEN as a bearer token.
+func serveControl(port int, token, certFile, keyFile string, c *control.Controller) {
+	addr := fmt.Sprintf(":%d", port)
+	if token == "" {
+		logger.With("addr", addr).Errorf("Not serving the control API without a CONTROL_TOKEN")
+		return
+	}
+
+	logger.With("addr", addr).Infof("Serving control API")
+	err := http.ListenAndServeTLS(addr, certFile, keyFile, control.NewHandler(c, token))
+	logger.With("addr", addr).With("error", err).Errorf("Control API stopped")
+}
+
 type Killer struct {
 	killDelay conf.DurationRange
 	kill      func()
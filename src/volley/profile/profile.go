@@ -0,0 +1,196 @@
+// Package profile holds the ways volley's consumers misbehave while reading
+// from Loggregator, e.g. reading slowly, in bursts or not at all.
+package profile
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"volley/control"
+)
+
+// Profile is how a consumer reads from its connections.
+type Profile interface {
+	// NewPacer returns the pacing of a single connection.
+	NewPacer() Pacer
+}
+
+// Pacer is called after each envelope a connection reads. It blocks for as
+// long as the connection should stop reading, or until ctx is done.
+type Pacer interface {
+	Wait(ctx context.Context, size int)
+}
+
+// Dialer is implemented by profiles that misbehave at the TCP level. Their
+// connections must be opened with Dial.
+type Dialer interface {
+	Dial(network, addr string, timeout time.Duration) (net.Conn, error)
+}
+
+// Uniform waits a random duration from the receive delay after every
+// envelope. The delay may change while connections are reading.
+type Uniform struct {
+	delay *control.Delay
+}
+
+func NewUniform(receiveDelay *control.Delay) *Uniform {
+	return &Uniform{
+		delay: receiveDelay,
+	}
+}
+
+func (u *Uniform) NewPacer() Pacer {
+	return u
+}
+
+func (u *Uniform) Wait(ctx context.Context, _ int) {
+	sleep(ctx, u.delay.Duration())
+}
+
+// Bursty reads as fast as it can for the read duration and then stops
+// reading for the stall duration, over and over.
+type Bursty struct {
+	read  time.Duration
+	stall time.Duration
+}
+
+func NewBursty(read, stall time.Duration) *Bursty {
+	return &Bursty{
+		read:  read,
+		stall: stall,
+	}
+}
+
+func (b *Bursty) NewPacer() Pacer {
+	return &burstyPacer{
+		Bursty: b,
+		start:  time.Now(),
+	}
+}
+
+type burstyPacer struct {
+	*Bursty
+	start time.Time
+}
+
+func (p *burstyPacer) Wait(ctx context.Context, _ int) {
+	if time.Since(p.start) < p.read {
+		return
+	}
+
+	sleep(ctx, p.stall)
+	p.start = time.Now()
+}
+
+// Stalled reads as fast as it can for the given duration and then never
+// reads again, while keeping the connection open.
+type Stalled struct {
+	after time.Duration
+}
+
+func NewStalled(after time.Duration) *Stalled {
+	return &Stalled{
+		after: after,
+	}
+}
+
+func (s *Stalled) NewPacer() Pacer {
+	return &stalledPacer{
+		stallAt: time.Now().Add(s.after),
+	}
+}
+
+type stalledPacer struct {
+	stallAt time.Time
+}
+
+func (p *stalledPacer) Wait(ctx context.Context, _ int) {
+	if time.Now().Before(p.stallAt) {
+		return
+	}
+
+	<-ctx.Done()
+}
+
+// Bandwidth reads no more than bytesPerSecond from each connection.
+type Bandwidth struct {
+	bytesPerSecond int
+}
+
+func NewBandwidth(bytesPerSecond int) *Bandwidth {
+	return &Bandwidth{
+		bytesPerSecond: bytesPerSecond,
+	}
+}
+
+func (b *Bandwidth) NewPacer() Pacer {
+	return &bandwidthPacer{
+		bytesPerSecond: float64(b.bytesPerSecond),
+		start:          time.Now(),
+	}
+}
+
+type bandwidthPacer struct {
+	bytesPerSecond float64
+	start          time.Time
+	read           float64
+}
+
+func (p *bandwidthPacer) Wait(ctx context.Context, size int) {
+	p.read += float64(size)
+	due := time.Duration(p.read / p.bytesPerSecond * float64(time.Second))
+	sleep(ctx, due-time.Since(p.start))
+}
+
+// HalfClose reads as fast as it can, but closes the sending side of each
+// TCP connection once it has been open for the given duration, as clients
+// that shut down their socket for writing do.
+type HalfClose struct {
+	after time.Duration
+}
+
+func NewHalfClose(after time.Duration) *HalfClose {
+	return &HalfClose{
+		after: after,
+	}
+}
+
+func (h *HalfClose) NewPacer() Pacer {
+	return h
+}
+
+func (h *HalfClose) Wait(context.Context, int) {}
+
+func (h *HalfClose) Dial(network, addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	time.AfterFunc(h.after, func() {
+		closeWrite(conn)
+	})
+
+	return conn, nil
+}
+
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,124 @@
+package profile_test
+
+import (
+	"conf"
+	"context"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"volley/control"
+	"volley/profile"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile", func() {
+	timeWait := func(p profile.Pacer, ctx context.Context, size int) time.Duration {
+		start := time.Now()
+		p.Wait(ctx, size)
+		return time.Since(start)
+	}
+
+	Describe("Uniform", func() {
+		It("waits for the current receive delay", func() {
+			delay := control.NewDelay(conf.DurationRange{})
+			pacer := profile.NewUniform(delay).NewPacer()
+			Expect(timeWait(pacer, context.Background(), 1)).To(BeNumerically("<", 10*time.Millisecond))
+
+			delay.Set(conf.DurationRange{Min: 50 * time.Millisecond, Max: 51 * time.Millisecond})
+			Expect(timeWait(pacer, context.Background(), 1)).To(BeNumerically(">=", 50*time.Millisecond))
+		})
+	})
+
+	Describe("Bursty", func() {
+		It("reads for the read duration and then stalls", func() {
+			pacer := profile.NewBursty(50*time.Millisecond, 100*time.Millisecond).NewPacer()
+
+			Expect(timeWait(pacer, context.Background(), 1)).To(BeNumerically("<", 10*time.Millisecond))
+
+			time.Sleep(50 * time.Millisecond)
+			Expect(timeWait(pacer, context.Background(), 1)).To(BeNumerically(">=", 100*time.Millisecond))
+
+			By("starting a new burst")
+			Expect(timeWait(pacer, context.Background(), 1)).To(BeNumerically("<", 10*time.Millisecond))
+		})
+	})
+
+	Describe("Stalled", func() {
+		It("stops reading until the connection ends", func() {
+			pacer := profile.NewStalled(20 * time.Millisecond).NewPacer()
+			Expect(timeWait(pacer, context.Background(), 1)).To(BeNumerically("<", 10*time.Millisecond))
+
+			time.Sleep(20 * time.Millisecond)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				pacer.Wait(ctx, 1)
+			}()
+
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Describe("Bandwidth", func() {
+		It("reads no faster than the limit", func() {
+			pacer := profile.NewBandwidth(10000).NewPacer()
+
+			start := time.Now()
+			for i := 0; i < 10; i++ {
+				pacer.Wait(context.Background(), 200)
+			}
+
+			Expect(time.Since(start)).To(BeNumerically("~", 200*time.Millisecond, 50*time.Millisecond))
+		})
+
+		It("returns once the connection ends", func() {
+			pacer := profile.NewBandwidth(1).NewPacer()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			Expect(timeWait(pacer, ctx, 1000)).To(BeNumerically("<", 10*time.Millisecond))
+		})
+	})
+
+	Describe("HalfClose", func() {
+		It("closes the sending side of connections after a while", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer l.Close()
+
+			received := make(chan []byte, 1)
+			go func() {
+				defer GinkgoRecover()
+				conn, err := l.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				b, err := ioutil.ReadAll(conn)
+				Expect(err).ToNot(HaveOccurred())
+				received <- b
+
+				_, err = conn.Write([]byte("still-listening"))
+				Expect(err).ToNot(HaveOccurred())
+			}()
+
+			halfClose := profile.NewHalfClose(50 * time.Millisecond)
+			conn, err := halfClose.Dial("tcp", l.Addr().String(), time.Second)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("hello"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(received).Should(Receive(Equal([]byte("hello"))))
+			b, err := ioutil.ReadAll(conn)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("still-listening"))
+		})
+	})
+})
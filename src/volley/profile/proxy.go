@@ -0,0 +1,88 @@
+package profile
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Proxy is an HTTP CONNECT proxy that opens its tunnels with a Dialer. It
+// lets a profile misbehave at the TCP level for clients, such as noaa, that
+// can be given a proxy but not a dialer.
+type Proxy struct {
+	dialer   Dialer
+	listener net.Listener
+}
+
+// NewProxy starts a Proxy on a loopback port.
+func NewProxy(d Dialer) (*Proxy, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		dialer:   d,
+		listener: l,
+	}
+	go http.Serve(l, p)
+
+	return p, nil
+}
+
+// URL is the address to give clients as their proxy.
+func (p *Proxy) URL() *url.URL {
+	return &url.URL{
+		Scheme: "http",
+		Host:   p.listener.Addr().String(),
+	}
+}
+
+// Close stops accepting tunnels. Open tunnels are left as they are.
+func (p *Proxy) Close() error {
+	return p.listener.Close()
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upstream, err := p.dialer.Dial("tcp", r.Host, 10*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "cannot hijack connection", http.StatusInternalServerError)
+		return
+	}
+
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	defer client.Close()
+	defer upstream.Close()
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return
+	}
+
+	go func() {
+		// This ends once the client stops writing or the dialer has
+		// closed the sending side of the upstream connection. Either way
+		// the upstream may still have something to say.
+		io.Copy(upstream, buf)
+		closeWrite(upstream)
+	}()
+
+	io.Copy(client, upstream)
+}
@@ -0,0 +1,73 @@
+package profile_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"volley/profile"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxy", func() {
+	It("tunnels connections dialed by the profile", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		received := make(chan []byte, 1)
+		go func() {
+			defer GinkgoRecover()
+			conn, err := l.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			// Only returns once the profile half-closes the tunnel.
+			b, err := ioutil.ReadAll(conn)
+			Expect(err).ToNot(HaveOccurred())
+			received <- b
+
+			_, err = conn.Write([]byte("still-listening"))
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		proxy, err := profile.NewProxy(profile.NewHalfClose(100 * time.Millisecond))
+		Expect(err).ToNot(HaveOccurred())
+		defer proxy.Close()
+
+		conn, err := net.Dial("tcp", proxy.URL().Host)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		addr := l.Addr().String()
+		_, err = conn.Write([]byte("CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n\r\n"))
+		Expect(err).ToNot(HaveOccurred())
+
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		_, err = conn.Write([]byte("hello"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(received).Should(Receive(Equal([]byte("hello"))))
+		b, err := ioutil.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("still-listening"))
+	})
+
+	It("only supports CONNECT", func() {
+		proxy, err := profile.NewProxy(profile.NewHalfClose(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		defer proxy.Close()
+
+		resp, err := http.Get(proxy.URL().String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,206 @@
+// Package scenario describes how volley loads Loggregator over time as a
+// list of phases, each with its own connection mix.
+package scenario
+
+import (
+	"conf"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Phase is a period of time with a fixed connection mix. A Phase without a
+// duration lasts until volley exits.
+type Phase struct {
+	Name              string
+	Duration          time.Duration
+	V1                V1Mix
+	V2                V2Mix
+	ReceiveDelay      conf.DurationRange
+	AsyncRequestDelay conf.DurationRange
+	SyslogDrains      int
+}
+
+// V1Mix is the number of each kind of V1 consumer.
+type V1Mix struct {
+	Firehose         int `yaml:"firehose"`
+	Stream           int `yaml:"stream"`
+	RecentLogs       int `yaml:"recent_logs"`
+	ContainerMetrics int `yaml:"container_metrics"`
+}
+
+// V2Mix is the number of V2 connections with each kind of selector.
+type V2Mix struct {
+	Firehose          int `yaml:"firehose"`
+	AppStream         int `yaml:"app_stream"`
+	AppLogStream      int `yaml:"app_log_stream"`
+	CounterStream     int `yaml:"counter_stream"`
+	GaugeStream       int `yaml:"gauge_stream"`
+	TimerStream       int `yaml:"timer_stream"`
+	EventStream       int `yaml:"event_stream"`
+	MultiSourceStream int `yaml:"multi_source_stream"`
+}
+
+type file struct {
+	Phases []phase `yaml:"phases"`
+}
+
+type phase struct {
+	Name              string `yaml:"name"`
+	Duration          string `yaml:"duration"`
+	V1                V1Mix  `yaml:"v1"`
+	V2                V2Mix  `yaml:"v2"`
+	ReceiveDelay      string `yaml:"receive_delay"`
+	AsyncRequestDelay string `yaml:"async_request_delay"`
+	SyslogDrains      int    `yaml:"syslog_drains"`
+}
+
+// Load reads the phases from a YAML or JSON scenario file.
+func Load(path string) ([]Phase, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses the phases of a YAML or JSON scenario, e.g.
+//
+//	phases:
+//	- name: ramp-up
+//	  duration: 5m
+//	  v1: {firehose: 5, stream: 10}
+//	  v2: {firehose: 5}
+//	  receive_delay: 1ms-10ms
+//	- name: steady
+//	  v1: {firehose: 10, stream: 20, recent_logs: 100}
+//	  async_request_delay: 1ms-1s
+func Parse(data []byte) ([]Phase, error) {
+	var f file
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, err
+	}
+
+	if len(f.Phases) == 0 {
+		return nil, errors.New("scenario has no phases")
+	}
+
+	phases := make([]Phase, 0, len(f.Phases))
+	for i, raw := range f.Phases {
+		p, err := raw.parse(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Duration == 0 && i < len(f.Phases)-1 {
+			return nil, fmt.Errorf("phase %s: only the last phase may run without a duration", p.Name)
+		}
+
+		phases = append(phases, p)
+	}
+
+	return phases, nil
+}
+
+func (raw phase) parse(i int) (Phase, error) {
+	p := Phase{
+		Name:         raw.Name,
+		V1:           raw.V1,
+		V2:           raw.V2,
+		SyslogDrains: raw.SyslogDrains,
+	}
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("phase-%d", i+1)
+	}
+
+	if raw.Duration != "" {
+		d, err := time.ParseDuration(raw.Duration)
+		if err != nil || d < 0 {
+			return Phase{}, fmt.Errorf("phase %s: invalid duration: %s", p.Name, raw.Duration)
+		}
+		p.Duration = d
+	}
+
+	var err error
+	p.ReceiveDelay, err = parseRange(raw.ReceiveDelay)
+	if err != nil {
+		return Phase{}, fmt.Errorf("phase %s: invalid receive_delay: %s", p.Name, err)
+	}
+
+	p.AsyncRequestDelay, err = parseRange(raw.AsyncRequestDelay)
+	if err != nil {
+		return Phase{}, fmt.Errorf("phase %s: invalid async_request_delay: %s", p.Name, err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return Phase{}, err
+	}
+
+	return p, nil
+}
+
+// Validate checks that the connection counts are not negative and that a
+// phase with recent logs or container metrics requests has a non-zero
+// async request delay to space them out.
+func (p Phase) Validate() error {
+	counts := []int{
+		p.V1.Firehose, p.V1.Stream, p.V1.RecentLogs, p.V1.ContainerMetrics,
+		p.V2.Firehose, p.V2.AppStream, p.V2.AppLogStream,
+		p.V2.CounterStream, p.V2.GaugeStream, p.V2.TimerStream, p.V2.EventStream,
+		p.V2.MultiSourceStream,
+		p.SyslogDrains,
+	}
+	for _, c := range counts {
+		if c < 0 {
+			return fmt.Errorf("phase %s: connection counts must not be negative", p.Name)
+		}
+	}
+
+	if (p.V1.RecentLogs > 0 || p.V1.ContainerMetrics > 0) && p.AsyncRequestDelay.Max <= 0 {
+		return fmt.Errorf("phase %s: async_request_delay must be above 0 with recent_logs or container_metrics", p.Name)
+	}
+
+	return nil
+}
+
+func parseRange(v string) (conf.DurationRange, error) {
+	var r conf.DurationRange
+	if v == "" {
+		return r, nil
+	}
+
+	if err := r.UnmarshalEnv(v); err != nil {
+		return r, err
+	}
+	if r.Min > r.Max {
+		return r, errors.New("min must be at most max")
+	}
+
+	return r, nil
+}
+
+// Run steps through the phases until they are over or ctx is done. For each
+// phase it calls start with a context that is done once the phase is over,
+// and waits for the phase to end before starting the next one. start should
+// not block.
+func Run(ctx context.Context, phases []Phase, start func(ctx context.Context, p Phase)) {
+	for _, p := range phases {
+		phaseCtx, cancel := context.WithCancel(ctx)
+		if p.Duration > 0 {
+			phaseCtx, cancel = context.WithTimeout(ctx, p.Duration)
+		}
+
+		start(phaseCtx, p)
+		<-phaseCtx.Done()
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
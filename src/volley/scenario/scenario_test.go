@@ -0,0 +1,181 @@
+package scenario_test
+
+import (
+	"conf"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"volley/scenario"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scenario", func() {
+	Describe("Parse", func() {
+		It("parses YAML phases", func() {
+			phases, err := scenario.Parse([]byte(`
+phases:
+- name: ramp-up
+  duration: 5m
+  v1:
+    firehose: 1
+    stream: 2
+    recent_logs: 3
+    container_metrics: 4
+  v2:
+    firehose: 5
+    app_stream: 6
+    app_log_stream: 7
+    counter_stream: 9
+    gauge_stream: 10
+    timer_stream: 11
+    event_stream: 12
+    multi_source_stream: 13
+  receive_delay: 1ms-10ms
+  async_request_delay: 1s-2s
+  syslog_drains: 8
+- name: steady
+  v1: {firehose: 10}
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(phases).To(Equal([]scenario.Phase{
+				{
+					Name:     "ramp-up",
+					Duration: 5 * time.Minute,
+					V1: scenario.V1Mix{
+						Firehose:         1,
+						Stream:           2,
+						RecentLogs:       3,
+						ContainerMetrics: 4,
+					},
+					V2: scenario.V2Mix{
+						Firehose:          5,
+						AppStream:         6,
+						AppLogStream:      7,
+						CounterStream:     9,
+						GaugeStream:       10,
+						TimerStream:       11,
+						EventStream:       12,
+						MultiSourceStream: 13,
+					},
+					ReceiveDelay:      conf.DurationRange{Min: time.Millisecond, Max: 10 * time.Millisecond},
+					AsyncRequestDelay: conf.DurationRange{Min: time.Second, Max: 2 * time.Second},
+					SyslogDrains:      8,
+				},
+				{
+					Name: "steady",
+					V1:   scenario.V1Mix{Firehose: 10},
+				},
+			}))
+		})
+
+		It("parses JSON phases", func() {
+			phases, err := scenario.Parse([]byte(`{
+				"phases": [
+					{"duration": "1m", "v2": {"firehose": 3}},
+					{"duration": "2m", "syslog_drains": 2}
+				]
+			}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(phases).To(Equal([]scenario.Phase{
+				{Name: "phase-1", Duration: time.Minute, V2: scenario.V2Mix{Firehose: 3}},
+				{Name: "phase-2", Duration: 2 * time.Minute, SyslogDrains: 2},
+			}))
+		})
+
+		DescribeTable("rejects invalid scenarios", func(s string) {
+			_, err := scenario.Parse([]byte(s))
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("no phases", `phases: []`),
+			Entry("unknown field", `phases: [{firehose: 1}]`),
+			Entry("invalid duration", `phases: [{duration: soon}]`),
+			Entry("negative duration", `phases: [{duration: -1m}]`),
+			Entry("invalid receive delay", `phases: [{receive_delay: 1ms}]`),
+			Entry("reversed async request delay", `phases: [{async_request_delay: 2s-1s}]`),
+			Entry("negative count", `phases: [{v1: {stream: -1}}]`),
+			Entry("recent logs without an async request delay", `phases: [{v1: {recent_logs: 1}}]`),
+			Entry("container metrics with a zero async request delay", `phases: [{v1: {container_metrics: 1}, async_request_delay: 0s-0s}]`),
+			Entry("endless phase before the last", `phases: [{name: a}, {name: b, duration: 1m}]`),
+		)
+	})
+
+	Describe("Load", func() {
+		It("reads the phases from a file", func() {
+			dir, err := ioutil.TempDir("", "scenario")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "scenario.yml")
+			err = ioutil.WriteFile(path, []byte("phases: [{name: spike, v1: {stream: 100}}]"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			phases, err := scenario.Load(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(phases).To(Equal([]scenario.Phase{
+				{Name: "spike", V1: scenario.V1Mix{Stream: 100}},
+			}))
+		})
+
+		It("returns an error for a missing file", func() {
+			_, err := scenario.Load("/does/not/exist")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Run", func() {
+		It("starts each phase once the previous one is over", func() {
+			phases := []scenario.Phase{
+				{Name: "a", Duration: 10 * time.Millisecond},
+				{Name: "b", Duration: 10 * time.Millisecond},
+			}
+
+			var (
+				mu      sync.Mutex
+				started []string
+				ctxs    []context.Context
+			)
+			scenario.Run(context.Background(), phases, func(ctx context.Context, p scenario.Phase) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				for _, c := range ctxs {
+					Expect(c.Err()).To(HaveOccurred())
+				}
+				started = append(started, p.Name)
+				ctxs = append(ctxs, ctx)
+			})
+
+			Expect(started).To(Equal([]string{"a", "b"}))
+			Expect(ctxs[1].Err()).To(HaveOccurred())
+		})
+
+		It("runs a phase without a duration until the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			phases := []scenario.Phase{{Name: "endless"}}
+
+			phaseCtxs := make(chan context.Context, 1)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				scenario.Run(ctx, phases, func(ctx context.Context, _ scenario.Phase) {
+					phaseCtxs <- ctx
+				})
+			}()
+
+			var phaseCtx context.Context
+			Eventually(phaseCtxs).Should(Receive(&phaseCtx))
+			Consistently(done).ShouldNot(BeClosed())
+
+			cancel()
+			Eventually(done).Should(BeClosed())
+			Expect(phaseCtx.Err()).To(HaveOccurred())
+		})
+	})
+})
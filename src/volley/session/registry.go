@@ -0,0 +1,167 @@
+// Package session tracks every connection volley has open, so they can be
+// counted accurately and torn down on purpose.
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metricbatcher"
+)
+
+// Gauge is given the number of open sessions of each type whenever it
+// changes.
+type Gauge interface {
+	Set(name string, tags map[string]string, value float64)
+}
+
+// Batcher is given a volley.openConnections count for every session opened
+// and a volley.closedConnections count for every session closed, so that
+// the open sessions can be worked out from the counters emitted to Metron.
+type Batcher interface {
+	BatchCounter(name string) metricbatcher.BatchCounterChainer
+}
+
+// Registry holds the open sessions. It is safe for concurrent use.
+type Registry struct {
+	gauge   Gauge
+	batcher Batcher
+
+	mu       sync.Mutex
+	nextID   uint64
+	sessions map[uint64]*Session
+	counts   map[string]int
+}
+
+// Session is a single connection with its own lifetime. It ends when it is
+// closed or when the context it was opened with is done.
+type Session struct {
+	Info
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	registry *Registry
+	once     sync.Once
+}
+
+// Info describes a session.
+type Info struct {
+	ID      uint64    `json:"id"`
+	Type    string    `json:"type"`
+	Target  string    `json:"target"`
+	Started time.Time `json:"started"`
+}
+
+func NewRegistry(g Gauge, b Batcher) *Registry {
+	return &Registry{
+		gauge:    g,
+		batcher:  b,
+		sessions: make(map[uint64]*Session),
+		counts:   make(map[string]int),
+	}
+}
+
+// Open registers a session of the connection type. The target describes
+// what it reads, e.g. a subscription or app ID. The session must be closed
+// once the connection ends.
+func (r *Registry) Open(ctx context.Context, connType, target string) *Session {
+	ctx, cancel := context.WithCancel(ctx)
+	defer r.count("volley.openConnections", connType)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	s := &Session{
+		Info: Info{
+			ID:      r.nextID,
+			Type:    connType,
+			Target:  target,
+			Started: time.Now(),
+		},
+		ctx:      ctx,
+		cancel:   cancel,
+		registry: r,
+	}
+	r.sessions[s.ID] = s
+	r.updateCount(connType, 1)
+
+	return s
+}
+
+// Context is done once the session is closed.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Close ends the session and removes it from the registry. It may be called
+// more than once.
+func (s *Session) Close() {
+	s.once.Do(func() {
+		s.cancel()
+		s.registry.remove(s)
+		s.registry.count("volley.closedConnections", s.Type)
+	})
+}
+
+// Close ends the session with the ID. It returns false if there is no such
+// session.
+func (r *Registry) Close(id uint64) bool {
+	r.mu.Lock()
+	s, ok := r.sessions[id]
+	r.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	s.Close()
+
+	return true
+}
+
+// List returns every open session, oldest first.
+func (r *Registry) List() []Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make([]Info, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		infos = append(infos, s.Info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+
+	return infos
+}
+
+// Count returns the number of open sessions of the connection type.
+func (r *Registry) Count(connType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.counts[connType]
+}
+
+func (r *Registry) remove(s *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sessions, s.ID)
+	r.updateCount(s.Type, -1)
+}
+
+func (r *Registry) count(name, connType string) {
+	r.batcher.BatchCounter(name).SetTag("conn_type", connType).Increment()
+}
+
+func (r *Registry) updateCount(connType string, delta int) {
+	r.counts[connType] += delta
+	r.gauge.Set(
+		"volley.openSessions",
+		map[string]string{"conn_type": connType},
+		float64(r.counts[connType]),
+	)
+}
@@ -0,0 +1,164 @@
+package session_test
+
+import (
+	"context"
+	"sync"
+
+	"volley/session"
+
+	"github.com/cloudfoundry/dropsonde/metricbatcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		gauge    *spyGauge
+		batcher  *spyBatcher
+		registry *session.Registry
+	)
+
+	BeforeEach(func() {
+		gauge = newSpyGauge()
+		batcher = newSpyBatcher()
+		registry = session.NewRegistry(gauge, batcher)
+	})
+
+	It("counts open sessions by type", func() {
+		registry.Open(context.Background(), "v1_firehose", "sub-id")
+		registry.Open(context.Background(), "v1_firehose", "sub-id")
+		s := registry.Open(context.Background(), "v1_stream", "app-id")
+
+		Expect(registry.Count("v1_firehose")).To(Equal(2))
+		Expect(registry.Count("v1_stream")).To(Equal(1))
+		Expect(gauge.Value("v1_firehose")).To(Equal(2.0))
+
+		s.Close()
+		s.Close()
+
+		Expect(registry.Count("v1_stream")).To(Equal(0))
+		Expect(gauge.Value("v1_stream")).To(Equal(0.0))
+	})
+
+	It("counts the sessions opened and closed", func() {
+		registry.Open(context.Background(), "v1_firehose", "sub-id")
+		s := registry.Open(context.Background(), "v1_firehose", "sub-id")
+
+		Expect(batcher.Count("volley.openConnections", "v1_firehose")).To(Equal(uint64(2)))
+		Expect(batcher.Count("volley.closedConnections", "v1_firehose")).To(BeZero())
+
+		s.Close()
+		s.Close()
+		registry.Close(s.ID)
+
+		Expect(batcher.Count("volley.closedConnections", "v1_firehose")).To(Equal(uint64(1)))
+	})
+
+	It("lists open sessions oldest first", func() {
+		first := registry.Open(context.Background(), "v1_firehose", "sub-id")
+		second := registry.Open(context.Background(), "v2_app_stream", "app-id")
+
+		infos := registry.List()
+		Expect(infos).To(HaveLen(2))
+		Expect(infos[0].ID).To(Equal(first.ID))
+		Expect(infos[0].Type).To(Equal("v1_firehose"))
+		Expect(infos[0].Target).To(Equal("sub-id"))
+		Expect(infos[0].Started).ToNot(BeZero())
+		Expect(infos[1].ID).To(Equal(second.ID))
+
+		first.Close()
+		Expect(registry.List()).To(ConsistOf(second.Info))
+	})
+
+	It("tears down a session by ID", func() {
+		s := registry.Open(context.Background(), "v1_firehose", "sub-id")
+
+		Expect(registry.Close(s.ID)).To(BeTrue())
+		Expect(s.Context().Err()).To(HaveOccurred())
+		Expect(registry.List()).To(BeEmpty())
+
+		Expect(registry.Close(s.ID)).To(BeFalse())
+	})
+
+	It("ends the session when its parent context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		s := registry.Open(ctx, "v1_firehose", "sub-id")
+
+		cancel()
+
+		Expect(s.Context().Err()).To(HaveOccurred())
+	})
+})
+
+type spyGauge struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newSpyGauge() *spyGauge {
+	return &spyGauge{
+		values: make(map[string]float64),
+	}
+}
+
+func (s *spyGauge) Set(name string, tags map[string]string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	Expect(name).To(Equal("volley.openSessions"))
+	s.values[tags["conn_type"]] = value
+}
+
+func (s *spyGauge) Value(connType string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.values[connType]
+}
+
+type spyBatcher struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newSpyBatcher() *spyBatcher {
+	return &spyBatcher{
+		counts: make(map[string]uint64),
+	}
+}
+
+func (s *spyBatcher) BatchCounter(name string) metricbatcher.BatchCounterChainer {
+	return &spyChainer{batcher: s, name: name}
+}
+
+// Count returns the total of the counter with the conn_type tag.
+func (s *spyBatcher) Count(name, connType string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counts[name+"/"+connType]
+}
+
+type spyChainer struct {
+	batcher  *spyBatcher
+	name     string
+	connType string
+}
+
+func (c *spyChainer) SetTag(key, value string) metricbatcher.BatchCounterChainer {
+	Expect(key).To(Equal("conn_type"))
+	c.connType = value
+	return c
+}
+
+func (c *spyChainer) Increment() {
+	c.Add(1)
+}
+
+func (c *spyChainer) Add(value uint64) {
+	c.batcher.mu.Lock()
+	defer c.batcher.mu.Unlock()
+
+	c.batcher.counts[c.name+"/"+c.connType] += value
+}
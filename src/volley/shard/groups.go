@@ -0,0 +1,71 @@
+// Package shard spreads firehose connections across several subscription
+// IDs, so that TrafficController and RLP fan out to more than one shard
+// group.
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Groups picks the subscription ID, or shard ID, of each firehose
+// connection at random in proportion to the weight of each group.
+type Groups struct {
+	ids        []string
+	cumulative []int
+	total      int
+}
+
+// NewGroups creates a group named after subscriptionID for each weight,
+// e.g. sub-0 and sub-1 for the weights 3 and 1. Without weights, or with a
+// single weight, every connection uses subscriptionID itself.
+func NewGroups(subscriptionID string, weights []int) (*Groups, error) {
+	if len(weights) <= 1 {
+		return &Groups{
+			ids:        []string{subscriptionID},
+			cumulative: []int{1},
+			total:      1,
+		}, nil
+	}
+
+	g := &Groups{}
+	for i, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("shard group %d has a negative weight", i)
+		}
+
+		g.total += w
+		g.ids = append(g.ids, fmt.Sprintf("%s-%d", subscriptionID, i))
+		g.cumulative = append(g.cumulative, g.total)
+	}
+
+	if g.total == 0 {
+		return nil, errors.New("at least one shard group must have a positive weight")
+	}
+
+	return g, nil
+}
+
+// Pick returns the ID of a random group.
+func (g *Groups) Pick() string {
+	n := rand.Intn(g.total)
+	for i, c := range g.cumulative {
+		if n < c {
+			return g.ids[i]
+		}
+	}
+
+	return g.ids[len(g.ids)-1]
+}
+
+// Sharded reports whether there is more than one group, i.e. shard group
+// weights were given.
+func (g *Groups) Sharded() bool {
+	return len(g.ids) > 1
+}
+
+// IDs returns the ID of every group.
+func (g *Groups) IDs() []string {
+	return append([]string(nil), g.ids...)
+}
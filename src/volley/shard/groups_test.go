@@ -0,0 +1,52 @@
+package shard_test
+
+import (
+	"volley/shard"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Groups", func() {
+	It("uses the subscription ID without weights", func() {
+		g, err := shard.NewGroups("some-sub-id", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(g.IDs()).To(Equal([]string{"some-sub-id"}))
+		Expect(g.Pick()).To(Equal("some-sub-id"))
+		Expect(g.Sharded()).To(BeFalse())
+	})
+
+	It("uses the subscription ID with a single weight", func() {
+		g, err := shard.NewGroups("some-sub-id", []int{5})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(g.IDs()).To(Equal([]string{"some-sub-id"}))
+	})
+
+	It("picks groups in proportion to their weights", func() {
+		g, err := shard.NewGroups("some-sub-id", []int{3, 0, 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g.IDs()).To(Equal([]string{"some-sub-id-0", "some-sub-id-1", "some-sub-id-2"}))
+		Expect(g.Sharded()).To(BeTrue())
+
+		picks := make(map[string]int)
+		for i := 0; i < 4000; i++ {
+			picks[g.Pick()]++
+		}
+
+		Expect(picks).ToNot(HaveKey("some-sub-id-1"))
+		Expect(picks["some-sub-id-0"]).To(BeNumerically("~", 3000, 200))
+		Expect(picks["some-sub-id-2"]).To(BeNumerically("~", 1000, 200))
+	})
+
+	It("returns an error for negative weights", func() {
+		_, err := shard.NewGroups("some-sub-id", []int{1, -1})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error when every weight is zero", func() {
+		_, err := shard.NewGroups("some-sub-id", []int{0, 0})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -12,8 +13,10 @@ type idGetter interface {
 }
 
 type CUPSHandler struct {
-	idGetter   idGetter
-	drainURLs  []string
+	idGetter  idGetter
+	drainURLs []string
+
+	mu         sync.Mutex
 	drainCount int
 }
 
@@ -27,6 +30,14 @@ func NewCUPSHandler(i idGetter, drainURLs []string, drainCount int) *CUPSHandler
 	}
 }
 
+// SetDrainCount changes the number of syslog drains provided.
+func (h *CUPSHandler) SetDrainCount(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.drainCount = n
+}
+
 func (h *CUPSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	resp := h.newResponse()
 
@@ -39,7 +50,11 @@ func (h *CUPSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *CUPSHandler) newResponse() map[string]interface{} {
 	bindings := make(map[string]interface{})
 
-	appIDs := h.idGetter.GetN(h.drainCount)
+	h.mu.Lock()
+	drainCount := h.drainCount
+	h.mu.Unlock()
+
+	appIDs := h.idGetter.GetN(drainCount)
 
 	drains := make([]string, 0, len(h.drainURLs))
 	for _, d := range h.drainURLs {
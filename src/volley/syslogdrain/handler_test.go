@@ -43,6 +43,26 @@ var _ = Describe("Handler", func() {
 			}
 		}`))
 	})
+
+	It("provides the latest number of drains", func() {
+		handler := syslogdrain.NewCUPSHandler(&SpyAppIDStore{}, []string{"syslog://drain-host.local"}, 3)
+		handler.SetDrainCount(1)
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		handler.ServeHTTP(rw, req)
+
+		body, err := ioutil.ReadAll(rw.Result().Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(simplifyHostnames(body)).To(MatchJSON(`{
+			"results": {
+				"app-id-1": {
+					"drains": ["syslog://drain-host.local/?drain-version=2.0"],
+					"hostname": "org.space.appname"
+				}
+			}
+		}`))
+	})
 })
 
 func simplifyHostnames(body []byte) []byte {
@@ -1,27 +1,33 @@
 package syslogdrain
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
-	"log"
 	"net/http"
+
+	"volley/scenario"
 )
 
 // ListenAndServe starts a TCP listener which emulates CAPI
-// and will provide the specified number of syslog drains
-// with corresponding URLs
+// and will provide the number of syslog drains set by each phase
+// with corresponding URLs. It returns once the listener fails.
 func ListenAndServe(
 	tlsConfig *tls.Config,
 	port int16,
 	idGetter idGetter,
 	drainURLs []string,
-	drainCount int,
-) {
+	phases []scenario.Phase,
+) error {
 	l, err := tls.Listen("tcp", fmt.Sprintf(":%d", port), tlsConfig)
 	if err != nil {
-		log.Panicf("Failed to start CUPS provider: %s", err)
+		return fmt.Errorf("Failed to start CUPS provider: %s", err)
 	}
 
-	handler := NewCUPSHandler(idGetter, drainURLs, drainCount)
-	log.Println(http.Serve(l, handler))
+	handler := NewCUPSHandler(idGetter, drainURLs, 0)
+	go scenario.Run(context.Background(), phases, func(_ context.Context, p scenario.Phase) {
+		handler.SetDrainCount(p.SyslogDrains)
+	})
+
+	return http.Serve(l, handler)
 }
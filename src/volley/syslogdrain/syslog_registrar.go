@@ -2,42 +2,46 @@ package syslogdrain
 
 import (
 	"crypto/sha1"
-	"log"
+	"logging"
 	"math/rand"
 	"path"
 	"time"
 
 	"github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
+
+	"volley/scenario"
 )
 
+var logger = logging.New("syslog_registrar")
+
 type IDGetter interface {
 	Get() (id string)
 }
 
 type SyslogRegistrar struct {
-	etcdAddrs  []string
-	drainURLs  []string
-	drainCount int
-	ttl        time.Duration
-	idGetter   IDGetter
+	etcdAddrs []string
+	drainURLs []string
+	phases    []scenario.Phase
+	ttl       time.Duration
+	idGetter  IDGetter
 }
 
 // NewSyslogRegistrar creates a SyslogRegistrar which will write various syslog
-// drain configuration details into etcd
+// drain configuration details into etcd at the start of each phase
 func NewSyslogRegistrar(
 	ttl time.Duration,
-	drainCount int,
+	phases []scenario.Phase,
 	drainURLs []string,
 	etcdAddrs []string,
 	idGetter IDGetter,
 ) *SyslogRegistrar {
 	return &SyslogRegistrar{
-		etcdAddrs:  etcdAddrs,
-		drainURLs:  drainURLs,
-		drainCount: drainCount,
-		ttl:        ttl,
-		idGetter:   idGetter,
+		etcdAddrs: etcdAddrs,
+		drainURLs: drainURLs,
+		phases:    phases,
+		ttl:       ttl,
+		idGetter:  idGetter,
 	}
 }
 
@@ -46,21 +50,28 @@ func (r *SyslogRegistrar) Start() {
 		return
 	}
 
-	c := r.setupClient()
-	for i := 0; i < r.drainCount; i++ {
-		AdvertiseRandom(r.idGetter, c, r.drainURLs, r.ttl)
+	c, err := r.setupClient()
+	if err != nil {
+		logger.With("error", err).Errorf("Failed to create etcd client")
+		return
 	}
+
+	scenario.Run(context.Background(), r.phases, func(_ context.Context, p scenario.Phase) {
+		for i := 0; i < p.SyslogDrains; i++ {
+			AdvertiseRandom(r.idGetter, c, r.drainURLs, r.ttl)
+		}
+	})
 }
 
-func (r *SyslogRegistrar) setupClient() client.KeysAPI {
+func (r *SyslogRegistrar) setupClient() (client.KeysAPI, error) {
 	c, err := client.New(client.Config{
 		Endpoints: r.etcdAddrs,
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return client.NewKeysAPI(c)
+	return client.NewKeysAPI(c), nil
 }
 
 type ETCDSetter interface {
@@ -68,14 +79,19 @@ type ETCDSetter interface {
 }
 
 // AdvertiseRandom advertises a random drain URL for the first app ID returned
-// from ids.
+// from ids. Nothing is advertised while ids has no app ID.
 func AdvertiseRandom(ids IDGetter, etcd ETCDSetter, drainURLs []string, ttl time.Duration) {
+	id := ids.Get()
+	if id == "" {
+		logger.Warnf("No app IDs known yet, not advertising a syslog drain")
+		return
+	}
+
 	drain := drainURLs[rand.Intn(len(drainURLs))]
 	drainHash := sha1.Sum([]byte(drain))
-	id := ids.Get()
 	key := path.Join("/loggregator", "services", id, string(drainHash[:]))
 	_, err := etcd.Set(context.Background(), key, drain, &client.SetOptions{TTL: ttl})
 	if err != nil {
-		log.Printf("etcd failed: %s", err)
+		logger.With("app_id", id).With("error", err).Warnf("etcd failed")
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"time"
+	"volley/scenario"
 	"volley/syslogdrain"
 
 	"github.com/coreos/etcd/client"
@@ -34,7 +35,7 @@ var _ = Describe("SyslogRegistrar", func() {
 	It("adds syslog drain bindings to etcd", func() {
 		r := syslogdrain.NewSyslogRegistrar(
 			time.Hour,
-			5,
+			[]scenario.Phase{{SyslogDrains: 5}},
 			[]string{"some-url"},
 			[]string{etcdserver.URL},
 			SpyIDGetter{},
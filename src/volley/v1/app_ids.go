@@ -0,0 +1,152 @@
+package v1
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReadIDFile reads the app IDs in a file with an ID on each line. Blank
+// lines and lines starting with # are ignored.
+func ReadIDFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		id := strings.TrimSpace(s.Text())
+		if id == "" || strings.HasPrefix(id, "#") {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, s.Err()
+}
+
+// WriteIDFile replaces the file with the app IDs, one on each line. The IDs
+// are written to a temporary file first, so that a volley killed while
+// writing leaves the previous file intact.
+func WriteIDFile(path string, ids []string) error {
+	var b bytes.Buffer
+	for _, id := range ids {
+		b.WriteString(id)
+		b.WriteByte('\n')
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+var appsClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+type appsPage struct {
+	Resources []struct {
+		GUID     string `json:"guid"`
+		Metadata struct {
+			GUID string `json:"guid"`
+		} `json:"metadata"`
+	} `json:"resources"`
+	Pagination struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
+	NextURL string `json:"next_url"`
+}
+
+// FetchAppIDs lists up to limit app GUIDs from a Cloud Controller apps
+// endpoint, e.g. https://api.example.com/v3/apps, following the V3
+// pagination links or the V2 next_url.
+func FetchAppIDs(appsURL, authToken string, limit int) ([]string, error) {
+	var ids []string
+	next := appsURL
+	for next != "" && len(ids) < limit {
+		page, err := fetchAppsPage(next, authToken)
+		if err != nil {
+			return ids, err
+		}
+
+		for _, r := range page.Resources {
+			id := r.GUID
+			if id == "" {
+				id = r.Metadata.GUID
+			}
+			if id != "" && len(ids) < limit {
+				ids = append(ids, id)
+			}
+		}
+
+		next, err = nextPage(next, page)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	return ids, nil
+}
+
+func fetchAppsPage(pageURL, authToken string) (appsPage, error) {
+	var page appsPage
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return page, err
+	}
+	req.Header.Set("Authorization", authToken)
+
+	resp, err := appsClient.Do(req)
+	if err != nil {
+		return page, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return page, fmt.Errorf("listing apps from %s failed with status %d", pageURL, resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	return page, err
+}
+
+// nextPage resolves the link to the next page, which is relative for the
+// V2 API.
+func nextPage(current string, page appsPage) (string, error) {
+	ref := page.NextURL
+	if page.Pagination.Next != nil {
+		ref = page.Pagination.Next.Href
+	}
+	if ref == "" {
+		return "", nil
+	}
+
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := base.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return next.String(), nil
+}
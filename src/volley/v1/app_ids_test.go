@@ -0,0 +1,115 @@
+package v1_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"volley/v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App IDs", func() {
+	Describe("ID files", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "volley-app-ids")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("reads the IDs that were written", func() {
+			path := filepath.Join(dir, "app_ids")
+			err := v1.WriteIDFile(path, []string{"some-id-1", "some-id-2", "some-id-2"})
+			Expect(err).ToNot(HaveOccurred())
+
+			ids, err := v1.ReadIDFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ids).To(Equal([]string{"some-id-1", "some-id-2", "some-id-2"}))
+		})
+
+		It("ignores blank lines and comments", func() {
+			path := filepath.Join(dir, "app_ids")
+			err := ioutil.WriteFile(path, []byte("# apps\nsome-id-1\n\n  some-id-2  \n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			ids, err := v1.ReadIDFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ids).To(Equal([]string{"some-id-1", "some-id-2"}))
+		})
+
+		It("returns an error when the file does not exist", func() {
+			_, err := v1.ReadIDFile(filepath.Join(dir, "missing"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("FetchAppIDs", func() {
+		var (
+			server *httptest.Server
+			auths  chan string
+		)
+
+		BeforeEach(func() {
+			auths = make(chan string, 10)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/v3/apps", func(w http.ResponseWriter, r *http.Request) {
+				auths <- r.Header.Get("Authorization")
+				if r.URL.Query().Get("page") == "2" {
+					fmt.Fprint(w, `{"pagination": {"next": null}, "resources": [{"guid": "app-3"}]}`)
+					return
+				}
+				fmt.Fprintf(w, `{"pagination": {"next": {"href": "%s/v3/apps?page=2"}}, "resources": [{"guid": "app-1"}, {"guid": "app-2"}]}`, server.URL)
+			})
+			mux.HandleFunc("/v2/apps", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("page") == "2" {
+					fmt.Fprint(w, `{"next_url": null, "resources": [{"metadata": {"guid": "app-3"}}]}`)
+					return
+				}
+				fmt.Fprint(w, `{"next_url": "/v2/apps?page=2", "resources": [{"metadata": {"guid": "app-1"}}]}`)
+			})
+			mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			})
+			server = httptest.NewServer(mux)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("follows the V3 pagination", func() {
+			ids, err := v1.FetchAppIDs(server.URL+"/v3/apps", "bearer some-token", 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ids).To(Equal([]string{"app-1", "app-2", "app-3"}))
+			Expect(auths).To(Receive(Equal("bearer some-token")))
+		})
+
+		It("follows the V2 next_url", func() {
+			ids, err := v1.FetchAppIDs(server.URL+"/v2/apps", "bearer some-token", 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ids).To(Equal([]string{"app-1", "app-3"}))
+		})
+
+		It("stops at the limit", func() {
+			ids, err := v1.FetchAppIDs(server.URL+"/v3/apps", "bearer some-token", 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ids).To(Equal([]string{"app-1", "app-2"}))
+			Expect(auths).To(HaveLen(1))
+		})
+
+		It("returns an error for a failed request", func() {
+			_, err := v1.FetchAppIDs(server.URL+"/broken", "bearer some-token", 10)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
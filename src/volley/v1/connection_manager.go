@@ -1,19 +1,28 @@
 package v1
 
 import (
-	"conf"
+	"context"
 	"crypto/tls"
-	"log"
+	"logging"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"sync"
-	"time"
+
+	"volley/profile"
+	"volley/session"
+	"volley/shard"
+	"volley/validate"
 
 	"github.com/cloudfoundry/dropsonde/envelope_extensions"
 	"github.com/cloudfoundry/dropsonde/metricbatcher"
 	"github.com/cloudfoundry/noaa/consumer"
 	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
 )
 
+var logger = logging.New("volley_v1")
+
 var (
 	openConnectionsMetric   = "openConnections"
 	closedConnectionsMetric = "closedConnections"
@@ -31,25 +40,46 @@ type Batcher interface {
 // ConnectionManager initiates random connections to a firehose, app
 // stream, container metric stream, or it makes a recent logs request.
 // The ConnectionManager connects to all proviuded Traffic Controllers.
+// Envelopes are read as the consumer profile says, e.g. slowly or in
+// bursts. Firehose connections are spread across the shard groups. Every
+// connection is tracked as a session, which also counts the connections
+// opened and closed. App stream envelopes are checked by the validator, if
+// any.
 type ConnectionManager struct {
-	consumers      []*consumer.Consumer
-	consumerLock   sync.Mutex
-	appStore       AppIDStore
-	batcher        Batcher
-	tcAddrs        []string
-	authToken      string
-	subscriptionID string
-	receiveDelay   conf.DurationRange
+	consumers    []*consumer.Consumer
+	consumerLock sync.Mutex
+	appStore     AppIDStore
+	batcher      Batcher
+	validator    *validate.Validator
+	tcAddrs      []string
+	authToken    string
+	shards       *shard.Groups
+	profile      profile.Profile
+	proxy        func(*http.Request) (*url.URL, error)
+	sessions     *session.Registry
 }
 
 func NewConnectionManager(
 	tcAddrs []string,
 	authToken string,
-	subscriptionID string,
-	receiveDelay conf.DurationRange,
+	shards *shard.Groups,
+	p profile.Profile,
 	appStore AppIDStore,
 	batcher Batcher,
+	validator *validate.Validator,
+	sessions *session.Registry,
 ) *ConnectionManager {
+	var proxy func(*http.Request) (*url.URL, error)
+	if d, ok := p.(profile.Dialer); ok {
+		// noaa cannot be given a dialer, so streams are tunneled through a
+		// proxy that dials for the profile.
+		pr, err := profile.NewProxy(d)
+		if err != nil {
+			logger.With("error", err).Errorf("Failed to start profile proxy, streams will connect directly")
+		} else {
+			proxy = http.ProxyURL(pr.URL())
+		}
+	}
 
 	var consumers []*consumer.Consumer
 	for _, tcAddrs := range tcAddrs {
@@ -58,13 +88,16 @@ func NewConnectionManager(
 	}
 
 	return &ConnectionManager{
-		consumers:      consumers,
-		appStore:       appStore,
-		batcher:        batcher,
-		tcAddrs:        tcAddrs,
-		authToken:      authToken,
-		subscriptionID: subscriptionID,
-		receiveDelay:   receiveDelay,
+		consumers: consumers,
+		appStore:  appStore,
+		batcher:   batcher,
+		validator: validator,
+		tcAddrs:   tcAddrs,
+		authToken: authToken,
+		shards:    shards,
+		profile:   p,
+		proxy:     proxy,
+		sessions:  sessions,
 	}
 }
 
@@ -76,36 +109,89 @@ func (c *ConnectionManager) pick() *consumer.Consumer {
 	return c.consumers[pos]
 }
 
-func (c *ConnectionManager) Firehose() {
-	consumer := c.pick()
-	msgs, errs := consumer.Firehose(c.subscriptionID, c.authToken)
-	c.batcher.BatchCounter("volley.openConnections").SetTag("conn_type", "firehose").Increment()
-	go c.consume(msgs, "firehose")
-	for err := range errs {
-		c.batcher.BatchCounter("volley.closedConnections").SetTag("conn_type", "firehose").Increment()
-		log.Printf("Error from %s: %v\n", c.subscriptionID, err.Error())
+// newConsumer creates a consumer of a random Traffic Controller for a
+// single connection, so that the connection can be closed on its own.
+func (c *ConnectionManager) newConsumer(ctx context.Context) *consumer.Consumer {
+	addr := c.tcAddrs[rand.Intn(len(c.tcAddrs))]
+	tc := consumer.New(addr, &tls.Config{InsecureSkipVerify: true}, c.proxy)
+	go func() {
+		<-ctx.Done()
+		tc.Close()
+	}()
+
+	return tc
+}
+
+// Firehose reads from a firehose connection of a random shard group until
+// ctx is done or its session is closed.
+func (c *ConnectionManager) Firehose(ctx context.Context) {
+	subscriptionID := c.shards.Pick()
+	s := c.sessions.Open(ctx, "v1_firehose", subscriptionID)
+	defer s.Close()
+
+	consumer := c.newConsumer(s.Context())
+	msgs, errs := consumer.Firehose(subscriptionID, c.authToken)
+	go c.consume(s.Context(), msgs, "firehose", subscriptionID, "")
+	for {
+		select {
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			logger.With("conn_type", "firehose").
+				With("subscription_id", subscriptionID).
+				With("error", err).
+				Warnf("Firehose connection failed")
+		case <-s.Context().Done():
+			return
+		}
 	}
 }
 
-func (c *ConnectionManager) Stream() {
-	consumer := c.pick()
+// Stream reads from an app stream until ctx is done or its session is
+// closed.
+func (c *ConnectionManager) Stream(ctx context.Context) {
 	appID := c.appStore.Get()
+	if appID == "" {
+		logger.With("conn_type", "stream").Warnf("No app IDs known yet, not opening stream")
+		return
+	}
+	s := c.sessions.Open(ctx, "v1_stream", appID)
+	defer s.Close()
+
+	consumer := c.newConsumer(s.Context())
 	msgs, errs := consumer.Stream(appID, c.authToken)
-	c.batcher.BatchCounter("volley.openConnections").SetTag("conn_type", "stream").Increment()
-	go c.consume(msgs, "stream")
-	for err := range errs {
-		c.batcher.BatchCounter("volley.closedConnections").SetTag("conn_type", "stream").Increment()
-		log.Printf("Error from %s: %v\n", appID, err.Error())
+	go c.consume(s.Context(), msgs, "stream", "", appID)
+	for {
+		select {
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			logger.With("conn_type", "stream").
+				With("app_id", appID).
+				With("error", err).
+				Warnf("Stream connection failed")
+		case <-s.Context().Done():
+			return
+		}
 	}
 }
 
 func (c *ConnectionManager) RecentLogs() {
 	consumer := c.pick()
 	appID := c.appStore.Get()
+	if appID == "" {
+		logger.With("conn_type", "recentlogs").Warnf("No app IDs known yet, skipping request")
+		return
+	}
 	_, err := consumer.RecentLogs(appID, c.authToken)
 	if err != nil {
 		c.batcher.BatchCounter("volley.numberOfRequestErrors").SetTag("conn_type", "recentlogs").Increment()
-		log.Printf("Error from %s: %v\n", appID, err.Error())
+		logger.With("conn_type", "recentlogs").
+			With("app_id", appID).
+			With("error", err).
+			Warnf("Recent logs request failed")
 		return
 	}
 	c.batcher.BatchCounter("volley.numberOfRequests").SetTag("conn_type", "recentlogs").Increment()
@@ -114,37 +200,44 @@ func (c *ConnectionManager) RecentLogs() {
 func (c *ConnectionManager) ContainerMetrics() {
 	consumer := c.pick()
 	appID := c.appStore.Get()
+	if appID == "" {
+		logger.With("conn_type", "containermetrics").Warnf("No app IDs known yet, skipping request")
+		return
+	}
 	_, err := consumer.ContainerMetrics(appID, c.authToken)
 	if err != nil {
 		c.batcher.BatchCounter("volley.numberOfRequestErrors").SetTag("conn_type", "containermetrics").Increment()
-		log.Printf("Error from %s: %v\n", appID, err.Error())
+		logger.With("conn_type", "containermetrics").
+			With("app_id", appID).
+			With("error", err).
+			Warnf("Container metrics request failed")
 		return
 	}
 	c.batcher.BatchCounter("volley.numberOfRequests").SetTag("conn_type", "containermetrics").Increment()
 }
 
-func (c *ConnectionManager) consume(msgs <-chan *events.Envelope, connType string) {
-	delta := int(c.receiveDelay.Max - c.receiveDelay.Min)
+// consume reads the envelopes of a connection. Envelopes of a firehose are
+// counted by shardID and envelopes of an app stream are validated against
+// the streamed appID.
+func (c *ConnectionManager) consume(ctx context.Context, msgs <-chan *events.Envelope, connType, shardID, streamAppID string) {
+	pacer := c.profile.NewPacer()
 	var count int
 	for msg := range msgs {
 		count++
 		if count%1000 == 0 {
-			c.batcher.BatchCounter("volley.receivedEnvelopes").SetTag("conn_type", connType).Add(1000)
+			counter := c.batcher.BatchCounter("volley.receivedEnvelopes").SetTag("conn_type", connType)
+			if shardID != "" {
+				counter = counter.SetTag("shard_id", shardID)
+			}
+			counter.Add(1000)
+		}
+		if streamAppID != "" {
+			c.validator.V1Stream(streamAppID, msg)
 		}
 		appID := envelope_extensions.GetAppId(msg)
 		if appID != "" && appID != envelope_extensions.SystemAppId {
 			c.appStore.Add(appID)
 		}
-		if delta == 0 {
-			continue
-		}
-		delay := c.receiveDelay.Min + time.Duration(rand.Intn(delta))
-		time.Sleep(delay)
-	}
-}
-
-func (c *ConnectionManager) Close() {
-	for _, consumer := range c.consumers {
-		consumer.Close()
+		pacer.Wait(ctx, proto.Size(msg))
 	}
 }
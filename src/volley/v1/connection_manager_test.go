@@ -2,15 +2,21 @@ package v1_test
 
 import (
 	"conf"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"log"
+	"metrics"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"time"
 
+	"volley/control"
+	"volley/profile"
+	"volley/session"
+	"volley/shard"
 	"volley/v1"
 
 	. "github.com/apoydence/eachers"
@@ -32,6 +38,8 @@ var _ = Describe("Connection", func() {
 		mockBatcher *mockBatcher
 		mockChainer *mockBatchCounterChainer
 		mockIDStore *mockAppIDStore
+		sessions    *session.Registry
+		shards      *shard.Groups
 		conn        *v1.ConnectionManager
 	)
 
@@ -45,14 +53,20 @@ var _ = Describe("Connection", func() {
 		mockChainer = newMockBatchCounterChainer()
 		testhelpers.AlwaysReturn(mockBatcher.BatchCounterOutput, mockChainer)
 		testhelpers.AlwaysReturn(mockChainer.SetTagOutput, mockChainer)
+		sessions = session.NewRegistry(metrics.NewRegistry(), mockBatcher)
+		var err error
+		shards, err = shard.NewGroups("some-sub-id", nil)
+		Expect(err).ToNot(HaveOccurred())
 
 		conn = v1.NewConnectionManager(
 			[]string{strings.Replace(server.URL, "http", "ws", 1)},
 			"some-auth",
-			"some-sub-id",
-			conf.DurationRange{},
+			shards,
+			profile.NewUniform(control.NewDelay(conf.DurationRange{})),
 			mockIDStore,
 			mockBatcher,
+			nil,
+			sessions,
 		)
 	})
 
@@ -68,37 +82,68 @@ var _ = Describe("Connection", func() {
 
 	Describe("Firehose", func() {
 		It("creates a connection to the firehose endpoint", func() {
-			go conn.Firehose()
+			go conn.Firehose(context.Background())
 
 			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
 			Consistently(handler.errs).ShouldNot(Receive())
 		})
 
+		It("closes the connection once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				conn.Firehose(ctx)
+			}()
+
+			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("tracks the connection as a session", func() {
+			go conn.Firehose(context.Background())
+
+			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
+			Eventually(func() int { return sessions.Count("v1_firehose") }).Should(Equal(1))
+
+			infos := sessions.List()
+			Expect(infos).To(HaveLen(1))
+			Expect(infos[0].Target).To(Equal("some-sub-id"))
+			Expect(sessions.Close(infos[0].ID)).To(BeTrue())
+
+			Eventually(func() int { return sessions.Count("v1_firehose") }).Should(Equal(0))
+		})
+
 		It("increments an openConnections metric when a new connection is made", func() {
-			go conn.Firehose()
+			go conn.Firehose(context.Background())
 
 			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.openConnections")))
-			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "firehose")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "v1_firehose")))
 			Eventually(mockChainer.IncrementCalled).Should(BeCalled())
 		})
 
-		It("increments a closedConnections metric when an error occurs", func() {
-			go conn.Firehose()
+		It("increments a closedConnections metric once the session closes", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			go conn.Firehose(ctx)
 
 			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.openConnections")))
-			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "firehose")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "v1_firehose")))
 			Eventually(mockChainer.IncrementCalled).Should(BeCalled())
 
 			handler.stop()
+			Consistently(mockBatcher.BatchCounterInput).ShouldNot(BeCalled(With("volley.closedConnections")))
+
+			cancel()
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.closedConnections")))
-			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "firehose")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "v1_firehose")))
 			Eventually(mockChainer.IncrementCalled).Should(BeCalled())
 		})
 
 		It("increments a receivedEnvelopes metric when new envelopes are received", func() {
-			go conn.Firehose()
+			go conn.Firehose(context.Background())
 
 			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
 
@@ -124,11 +169,13 @@ var _ = Describe("Connection", func() {
 
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.receivedEnvelopes")))
 			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "firehose")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("shard_id", "some-sub-id")))
 			Eventually(mockChainer.AddInput).Should(BeCalled(With(uint64(1000))))
 
 			By("batching by 1000")
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.receivedEnvelopes")))
 			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "firehose")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("shard_id", "some-sub-id")))
 			Eventually(mockChainer.AddInput).Should(BeCalled(With(uint64(1000))))
 		})
 
@@ -136,16 +183,18 @@ var _ = Describe("Connection", func() {
 			slowConn := v1.NewConnectionManager(
 				[]string{strings.Replace(server.URL, "http", "ws", 1)},
 				"some-auth",
-				"some-sub-id",
-				conf.DurationRange{
+				shards,
+				profile.NewUniform(control.NewDelay(conf.DurationRange{
 					Min: 99 * time.Millisecond,
 					Max: 100 * time.Millisecond,
-				},
+				})),
 				mockIDStore,
 				mockBatcher,
+				nil,
+				sessions,
 			)
 
-			go slowConn.Firehose()
+			go slowConn.Firehose(context.Background())
 
 			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
 			go handler.sendLoop(10000000)
@@ -155,8 +204,51 @@ var _ = Describe("Connection", func() {
 			Expect(err.Error()).To(ContainSubstring("i/o timeout"))
 		})
 
+		It("stops reading with a stalled profile", func() {
+			stalledConn := v1.NewConnectionManager(
+				[]string{strings.Replace(server.URL, "http", "ws", 1)},
+				"some-auth",
+				shards,
+				profile.NewStalled(0),
+				mockIDStore,
+				mockBatcher,
+				nil,
+				sessions,
+			)
+
+			go stalledConn.Firehose(context.Background())
+
+			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
+			go handler.sendLoop(10000000)
+			var err error
+			Eventually(handler.errs).Should(Receive(&err))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("i/o timeout"))
+		})
+
+		It("spreads connections across the shard groups", func() {
+			shards, err := shard.NewGroups("some-sub-id", []int{1, 1})
+			Expect(err).ToNot(HaveOccurred())
+			conn = v1.NewConnectionManager(
+				[]string{strings.Replace(server.URL, "http", "ws", 1)},
+				"some-auth",
+				shards,
+				profile.NewUniform(control.NewDelay(conf.DurationRange{})),
+				mockIDStore,
+				mockBatcher,
+				nil,
+				sessions,
+			)
+
+			go conn.Firehose(context.Background())
+
+			var subID string
+			Eventually(handler.firehoseSubs).Should(Receive(&subID))
+			Expect(subID).To(BeElementOf("some-sub-id-0", "some-sub-id-1"))
+		})
+
 		It("ignores system app IDs", func() {
-			go conn.Firehose()
+			go conn.Firehose(context.Background())
 
 			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
 
@@ -180,7 +272,7 @@ var _ = Describe("Connection", func() {
 		})
 
 		DescribeTable("app ID store event types", func(ev *events.Envelope, appID string) {
-			go conn.Firehose()
+			go conn.Firehose(context.Background())
 
 			Eventually(handler.firehoseSubs).Should(Receive(Equal("some-sub-id")))
 
@@ -245,39 +337,43 @@ var _ = Describe("Connection", func() {
 
 	Describe("Stream", func() {
 		It("creates a connection to the stream endpoint", func() {
-			go conn.Stream()
+			go conn.Stream(context.Background())
 
 			Eventually(handler.streamApps).Should(Receive())
 			Consistently(handler.errs).ShouldNot(Receive())
 		})
 
 		It("increments an openConnections metric when a new connection is made", func() {
-			go conn.Stream()
+			go conn.Stream(context.Background())
 
 			Eventually(handler.streamApps).Should(Receive())
 			Consistently(handler.errs).ShouldNot(Receive())
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.openConnections")))
-			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "stream")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "v1_stream")))
 			Eventually(mockChainer.IncrementCalled).Should(BeCalled())
 		})
 
-		It("increments a closedConnections metric when an error occurs", func() {
-			go conn.Stream()
+		It("increments a closedConnections metric once the session closes", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			go conn.Stream(ctx)
 
 			Eventually(handler.streamApps).Should(Receive())
 			Consistently(handler.errs).ShouldNot(Receive())
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.openConnections")))
-			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "stream")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "v1_stream")))
 			Eventually(mockChainer.IncrementCalled).Should(BeCalled())
 
 			handler.stop()
+			Consistently(mockBatcher.BatchCounterInput).ShouldNot(BeCalled(With("volley.closedConnections")))
+
+			cancel()
 			Eventually(mockBatcher.BatchCounterInput).Should(BeCalled(With("volley.closedConnections")))
-			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "stream")))
+			Eventually(mockChainer.SetTagInput).Should(BeCalled(With("conn_type", "v1_stream")))
 			Eventually(mockChainer.IncrementCalled).Should(BeCalled())
 		})
 
 		It("increments a receivedEnvelopes metric when new envelopes are received", func() {
-			go conn.Stream()
+			go conn.Stream(context.Background())
 
 			Eventually(handler.streamApps).Should(Receive())
 
@@ -314,16 +410,18 @@ var _ = Describe("Connection", func() {
 			slowConn := v1.NewConnectionManager(
 				[]string{strings.Replace(server.URL, "http", "ws", 1)},
 				"some-auth",
-				"some-sub-id",
-				conf.DurationRange{
+				shards,
+				profile.NewUniform(control.NewDelay(conf.DurationRange{
 					Min: 99 * time.Millisecond,
 					Max: 100 * time.Millisecond,
-				},
+				})),
 				mockIDStore,
 				mockBatcher,
+				nil,
+				sessions,
 			)
 
-			go slowConn.Stream()
+			go slowConn.Stream(context.Background())
 
 			Eventually(handler.streamApps).Should(Receive())
 			go handler.sendLoop(10000000)
@@ -0,0 +1,83 @@
+package v1
+
+import "math"
+
+// Distribution weighs the apps of an IDStore when picking them. The apps
+// are ranked by how often they are stored, i.e. how much firehose traffic
+// they have, and counts holds the number of times each is stored, most
+// first.
+type Distribution interface {
+	Weights(counts []int) []float64
+}
+
+// Uniform picks each stored ID equally, so apps are picked as often as
+// they are seen on the firehose.
+type Uniform struct{}
+
+func NewUniform() Uniform {
+	return Uniform{}
+}
+
+func (Uniform) Weights(counts []int) []float64 {
+	w := make([]float64, len(counts))
+	for i, c := range counts {
+		w[i] = float64(c)
+	}
+
+	return w
+}
+
+// Zipf picks the app of rank k in proportion to 1/k^exponent, so a few of
+// the busiest apps get most of the consumers.
+type Zipf struct {
+	exponent float64
+}
+
+func NewZipf(exponent float64) Zipf {
+	return Zipf{exponent: exponent}
+}
+
+func (z Zipf) Weights(counts []int) []float64 {
+	w := make([]float64, len(counts))
+	for i := range counts {
+		w[i] = 1 / math.Pow(float64(i+1), z.exponent)
+	}
+
+	return w
+}
+
+// HotSet picks one of the size busiest apps with the probability fraction
+// and one of the other apps otherwise.
+type HotSet struct {
+	size     int
+	fraction float64
+}
+
+func NewHotSet(size int, fraction float64) HotSet {
+	return HotSet{
+		size:     size,
+		fraction: fraction,
+	}
+}
+
+func (h HotSet) Weights(counts []int) []float64 {
+	hot := h.size
+	if hot > len(counts) {
+		hot = len(counts)
+	}
+	cold := len(counts) - hot
+
+	w := make([]float64, len(counts))
+	for i := range w {
+		switch {
+		case cold == 0:
+			w[i] = 1
+		case i < hot:
+			w[i] = h.fraction / float64(hot)
+		default:
+			w[i] = (1 - h.fraction) / float64(cold)
+		}
+	}
+
+	return w
+}
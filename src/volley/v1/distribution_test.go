@@ -0,0 +1,112 @@
+package v1_test
+
+import (
+	"fmt"
+	"volley/v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Distribution", func() {
+	Describe("Uniform", func() {
+		It("weighs apps by how often they are stored", func() {
+			Expect(v1.NewUniform().Weights([]int{3, 2, 1})).To(Equal([]float64{3, 2, 1}))
+		})
+	})
+
+	Describe("Zipf", func() {
+		It("weighs apps by their rank", func() {
+			w := v1.NewZipf(1).Weights([]int{1, 1, 1, 1})
+			Expect(w).To(Equal([]float64{1, 1.0 / 2, 1.0 / 3, 1.0 / 4}))
+		})
+	})
+
+	Describe("HotSet", func() {
+		It("gives the hot apps the fraction", func() {
+			w := v1.NewHotSet(2, 0.8).Weights([]int{5, 4, 3, 2, 1})
+			Expect(w[0]).To(BeNumerically("~", 0.4))
+			Expect(w[1]).To(BeNumerically("~", 0.4))
+			Expect(w[2]).To(BeNumerically("~", 0.2/3))
+			Expect(w[4]).To(BeNumerically("~", 0.2/3))
+		})
+
+		It("weighs every app equally when they are all hot", func() {
+			Expect(v1.NewHotSet(5, 0.8).Weights([]int{2, 1})).To(Equal([]float64{1, 1}))
+		})
+	})
+
+	Describe("picking from an IDStore", func() {
+		var ranked []string
+
+		fill := func(store *v1.IDStore) {
+			// app-0 is the busiest and app-9 the quietest.
+			ranked = nil
+			for i := 0; i < 10; i++ {
+				id := fmt.Sprintf("app-%d", i)
+				ranked = append(ranked, id)
+				for j := 0; j < 10-i; j++ {
+					store.Add(id)
+				}
+			}
+		}
+
+		It("picks the busiest apps most with Zipf", func() {
+			store := v1.NewIDStore(55, 0, v1.NewZipf(2))
+			fill(store)
+
+			picks := make(map[string]int)
+			for i := 0; i < 10000; i++ {
+				picks[store.Get()]++
+			}
+
+			// 1/(1+1/4+1/9+...) of the picks go to the busiest app.
+			Expect(picks["app-0"]).To(BeNumerically("~", 6450, 300))
+			Expect(picks["app-1"]).To(BeNumerically("~", 1610, 200))
+			Expect(picks["app-0"]).To(BeNumerically(">", picks["app-9"]*50))
+		})
+
+		It("picks the hot set most with HotSet", func() {
+			store := v1.NewIDStore(55, 0, v1.NewHotSet(2, 0.9))
+			fill(store)
+
+			var hot int
+			for i := 0; i < 10000; i++ {
+				if id := store.Get(); id == "app-0" || id == "app-1" {
+					hot++
+				}
+			}
+			Expect(hot).To(BeNumerically("~", 9000, 200))
+		})
+
+		It("returns distinct IDs from GetN", func() {
+			store := v1.NewIDStore(55, 0, v1.NewZipf(1))
+			fill(store)
+
+			ids := store.GetN(5)
+			Expect(ids).To(HaveLen(5))
+			seen := make(map[string]bool)
+			for _, id := range ids {
+				Expect(seen).ToNot(HaveKey(id))
+				seen[id] = true
+			}
+
+			Expect(store.GetN(20)).To(ConsistOf(ranked))
+		})
+
+		It("favours the hot set in GetN", func() {
+			store := v1.NewIDStore(55, 0, v1.NewHotSet(2, 0.99))
+			fill(store)
+
+			var hot int
+			for i := 0; i < 1000; i++ {
+				for _, id := range store.GetN(2) {
+					if id == "app-0" || id == "app-1" {
+						hot++
+					}
+				}
+			}
+			Expect(hot).To(BeNumerically(">", 1800))
+		})
+	})
+})
@@ -2,86 +2,147 @@ package v1
 
 import (
 	"conf"
-	"math/rand"
+	"context"
 	"time"
+
+	"volley/control"
+	"volley/profile"
+	"volley/scenario"
+	"volley/session"
+	"volley/shard"
+	"volley/validate"
 )
 
 type EgressV1 struct {
-	firehoseCount        int
-	streamCount          int
-	recentLogCount       int
-	containerMetricCount int
-	tcAddrs              []string
-	authToken            string
-	subscriptionID       string
-	receiveDelay         conf.DurationRange
-	asyncRequestDelay    conf.DurationRange
-	idStore              AppIDStore
-	batcher              Batcher
+	phases             []scenario.Phase
+	receiveDelay       *control.Delay
+	asyncRequestDelay  *control.Delay
+	continuousRequests bool
+	conn               *ConnectionManager
+	firehoses          *control.Pool
+	streams            *control.Pool
+	recentLogs         *control.Pool
+	containerMetrics   *control.Pool
 }
 
 // NewEgressV1 creates consumers of Loggregator. Consumers may be firehose
 // connections, application streams, recent logs requests, or container
-// metrics. Note that the number of consumers of a particular type are also
-// configurable, e.g., we may have 10 firehose consumers, 5 application
-// streams, 15 recent log requests, etc.
+// metrics requests. The number of consumers of each type, and how slowly
+// they read, is set by each phase, e.g., we may ramp up to 10 firehose
+// consumers, 5 application streams and 15 recent log requests.
+//
+// Each phase makes its number of recent logs and container metrics
+// requests once, waiting the async request delay between them. With
+// continuousRequests the numbers are instead clients that keep requesting,
+// waiting the delay between their requests, for as long as the phase lasts.
 func NewEgressV1(
-	firehoseCount int,
-	streamCount int,
-	recentLogCount int,
-	containerMetricCount int,
+	phases []scenario.Phase,
 	tcAddrs []string,
 	authToken string,
-	subscriptionID string,
-	receiveDelay conf.DurationRange,
-	asyncRequestDelay conf.DurationRange,
+	shards *shard.Groups,
+	receiveDelay *control.Delay,
+	p profile.Profile,
 	idStore AppIDStore,
 	batcher Batcher,
+	validator *validate.Validator,
+	sessions *session.Registry,
+	continuousRequests bool,
 ) *EgressV1 {
+	conn := NewConnectionManager(
+		tcAddrs,
+		authToken,
+		shards,
+		p,
+		idStore,
+		batcher,
+		validator,
+		sessions,
+	)
+	asyncRequestDelay := control.NewDelay(conf.DurationRange{})
+
 	return &EgressV1{
-		firehoseCount:        firehoseCount,
-		streamCount:          streamCount,
-		recentLogCount:       recentLogCount,
-		containerMetricCount: containerMetricCount,
-		tcAddrs:              tcAddrs,
-		authToken:            authToken,
-		subscriptionID:       subscriptionID,
-		receiveDelay:         receiveDelay,
-		asyncRequestDelay:    asyncRequestDelay,
-		idStore:              idStore,
-		batcher:              batcher,
+		phases:             phases,
+		receiveDelay:       receiveDelay,
+		asyncRequestDelay:  asyncRequestDelay,
+		continuousRequests: continuousRequests,
+		conn:               conn,
+		firehoses:          control.NewPool(conn.Firehose),
+		streams:            control.NewPool(conn.Stream),
+		recentLogs:         control.NewPool(repeat(asyncRequestDelay, conn.RecentLogs)),
+		containerMetrics:   control.NewPool(repeat(asyncRequestDelay, conn.ContainerMetrics)),
 	}
 }
 
-// Start initiates all the configured consumers
-func (e EgressV1) Start() {
-	conn := NewConnectionManager(
-		e.tcAddrs,
-		e.authToken,
-		e.subscriptionID,
-		e.receiveDelay,
-		e.idStore,
-		e.batcher,
-	)
-	defer conn.Close()
+// Pools returns the consumers of each type so they can be controlled while
+// volley is running. Recent logs and container metrics clients are only
+// pools when they request continuously.
+func (e *EgressV1) Pools() map[string]*control.Pool {
+	pools := map[string]*control.Pool{
+		"v1_firehose": e.firehoses,
+		"v1_stream":   e.streams,
+	}
+	if e.continuousRequests {
+		pools["v1_recent_logs"] = e.recentLogs
+		pools["v1_container_metrics"] = e.containerMetrics
+	}
 
-	go e.syncRequest(e.firehoseCount, conn.Firehose)
-	go e.syncRequest(e.streamCount, conn.Stream)
-	go e.asyncRequest(e.asyncRequestDelay, e.recentLogCount, conn.RecentLogs)
-	go e.asyncRequest(e.asyncRequestDelay, e.containerMetricCount, conn.ContainerMetrics)
+	return pools
 }
 
-func (e *EgressV1) syncRequest(count int, endpoint func()) {
-	for i := 0; i < count; i++ {
-		go endpoint()
+// Start steps through the phases, scaling the consumers of each type to
+// the phase's mix. Every consumer is closed once the last phase is over.
+func (e *EgressV1) Start() {
+	scenario.Run(context.Background(), e.phases, e.startPhase)
+	e.scale(scenario.V1Mix{})
+}
+
+func (e *EgressV1) startPhase(ctx context.Context, p scenario.Phase) {
+	logger.With("phase", p.Name).Infof("Starting V1 phase")
+	e.receiveDelay.Set(p.ReceiveDelay)
+	e.asyncRequestDelay.Set(p.AsyncRequestDelay)
+	e.scale(p.V1)
+
+	if !e.continuousRequests {
+		go requestN(ctx, e.asyncRequestDelay, p.V1.RecentLogs, e.conn.RecentLogs)
+		go requestN(ctx, e.asyncRequestDelay, p.V1.ContainerMetrics, e.conn.ContainerMetrics)
+	}
+}
+
+func (e *EgressV1) scale(m scenario.V1Mix) {
+	e.firehoses.Scale(m.Firehose)
+	e.streams.Scale(m.Stream)
+	if e.continuousRequests {
+		e.recentLogs.Scale(m.RecentLogs)
+		e.containerMetrics.Scale(m.ContainerMetrics)
 	}
 }
 
-func (e *EgressV1) asyncRequest(delay conf.DurationRange, count int, endpoint func()) {
-	delta := int(delay.Max - delay.Min)
+// requestN starts count requests, waiting for the delay after starting
+// each, until ctx is done.
+func requestN(ctx context.Context, delay *control.Delay, count int, request func()) {
 	for i := 0; i < count; i++ {
-		delay := delay.Min + time.Duration(rand.Intn(delta))
-		go endpoint()
-		time.Sleep(delay)
+		go request()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay.Duration()):
+		}
+	}
+}
+
+// repeat makes requests one after another, waiting for the delay between
+// each, until ctx is done.
+func repeat(delay *control.Delay, request func()) func(context.Context) {
+	return func(ctx context.Context) {
+		for {
+			request()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay.Duration()):
+			}
+		}
 	}
 }
@@ -4,6 +4,7 @@ package v1_test
 
 import (
 	"log"
+	"logging"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -19,5 +20,6 @@ func TestConnection(t *testing.T) {
 var _ = BeforeSuite(func() {
 	if !testing.Verbose() {
 		log.SetOutput(GinkgoWriter)
+		logging.SetOutput(GinkgoWriter)
 	}
 })
@@ -1,23 +1,58 @@
 package v1
 
 import (
+	"math"
 	"math/rand"
+	"sort"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
+// rankTTL is how long the ranking of the apps is used before the store is
+// ranked again.
+const rankTTL = time.Second
+
+// IDStore is a ring of the app IDs seen on firehose traffic, or seeded
+// from a previous run or a listing of apps.
 type IDStore struct {
 	ids      []unsafe.Pointer
 	writeIDX int64
 	filled   chan struct{}
+	timedOut chan struct{}
+	dist     Distribution
+
+	mu      sync.Mutex
+	ranking ranking
+}
+
+// ranking is the distinct apps of the store, busiest first, with the
+// cumulative weights the distribution gives them.
+type ranking struct {
+	ids        []string
+	weights    []float64
+	cumulative []float64
+	stored     int
+	ranked     time.Time
 }
 
-func NewIDStore(len int) *IDStore {
-	return &IDStore{
+// NewIDStore creates a store of len app IDs, picked as the distribution
+// says. Get blocks until the store is full or getTimeout has passed. A
+// getTimeout of 0 waits for the store to be full.
+func NewIDStore(len int, getTimeout time.Duration, dist Distribution) *IDStore {
+	i := &IDStore{
 		ids:      make([]unsafe.Pointer, len),
 		writeIDX: -1,
 		filled:   make(chan struct{}),
+		dist:     dist,
+	}
+	if getTimeout > 0 {
+		i.timedOut = make(chan struct{})
+		time.AfterFunc(getTimeout, func() { close(i.timedOut) })
 	}
+
+	return i
 }
 
 func (i *IDStore) Add(id string) {
@@ -29,31 +64,152 @@ func (i *IDStore) Add(id string) {
 	atomic.StorePointer(&i.ids[idx], unsafe.Pointer(&id))
 }
 
+// Seed adds each of the IDs, e.g. those saved by a previous run.
+func (i *IDStore) Seed(ids []string) {
+	for _, id := range ids {
+		i.Add(id)
+	}
+}
+
+// Get picks an app ID as the distribution says. Once the get timeout has
+// passed it returns an empty ID while the store is empty, so that callers
+// can back off and try again.
 func (i *IDStore) Get() string {
-	<-i.filled
-	idx := rand.Intn(len(i.ids))
-	v := (*string)(atomic.LoadPointer(&i.ids[idx]))
-	return *v
+	select {
+	case <-i.filled:
+	case <-i.timedOut:
+	}
+
+	r := i.rank()
+	if len(r.ids) == 0 {
+		return ""
+	}
+
+	total := r.cumulative[len(r.cumulative)-1]
+	if total <= 0 {
+		return r.ids[rand.Intn(len(r.ids))]
+	}
+
+	idx := sort.SearchFloat64s(r.cumulative, rand.Float64()*total)
+	if idx >= len(r.ids) {
+		idx = len(r.ids) - 1
+	}
+	return r.ids[idx]
 }
 
+// GetN returns up to n distinct app IDs, picked without replacement as the
+// distribution says.
 func (i *IDStore) GetN(n int) []string {
-	wid := atomic.LoadInt64(&i.writeIDX)
+	if i.stored() == 0 {
+		return []string{}
+	}
 
-	if wid >= int64(len(i.ids)) {
-		wid = int64(len(i.ids) - 1)
+	r := i.rank()
+	if n > len(r.ids) {
+		n = len(r.ids)
 	}
-	if int64(n) > wid+1 {
-		n = int(wid + 1)
+
+	// Each app is keyed by u^(1/w) for a random u and the apps with the
+	// largest keys are picked, which picks them in proportion to their
+	// weights. Apps without weight are only picked when there are no
+	// others left.
+	keys := make([]float64, len(r.ids))
+	order := make([]int, len(r.ids))
+	for j, w := range r.weights {
+		order[j] = j
+		keys[j] = -1
+		if w > 0 {
+			keys[j] = math.Pow(rand.Float64(), 1/w)
+		}
 	}
+	sort.Slice(order, func(a, b int) bool {
+		return keys[order[a]] > keys[order[b]]
+	})
 
 	ids := make([]string, n)
-	for j := 0; j < n; j++ {
-		ids[j] = *(*string)(atomic.LoadPointer(&i.ids[j]))
+	for j := range ids {
+		ids[j] = r.ids[order[j]]
 	}
 	shuffle(ids)
 	return ids
 }
 
+// IDs returns every stored ID, as many times as it is stored, so that
+// saving and seeding them keeps how busy each app is.
+func (i *IDStore) IDs() []string {
+	stored := i.stored()
+	ids := make([]string, 0, stored)
+	for j := 0; j < stored; j++ {
+		// Add counts an ID before storing it.
+		if p := atomic.LoadPointer(&i.ids[j]); p != nil {
+			ids = append(ids, *(*string)(p))
+		}
+	}
+
+	return ids
+}
+
+// rank returns the apps ranked by how often they are stored. The ranking
+// is kept for rankTTL, as long as the store has not grown, since the
+// firehose adds an ID for every envelope.
+func (i *IDStore) rank() ranking {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	stored := i.stored()
+	if stored == i.ranking.stored && len(i.ranking.ids) > 0 && time.Since(i.ranking.ranked) < rankTTL {
+		return i.ranking
+	}
+
+	counts := make(map[string]int)
+	for _, id := range i.IDs() {
+		counts[id]++
+	}
+
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		if counts[ids[a]] != counts[ids[b]] {
+			return counts[ids[a]] > counts[ids[b]]
+		}
+		return ids[a] < ids[b]
+	})
+
+	ranked := make([]int, len(ids))
+	for j, id := range ids {
+		ranked[j] = counts[id]
+	}
+	weights := i.dist.Weights(ranked)
+
+	cumulative := make([]float64, len(weights))
+	var total float64
+	for j, w := range weights {
+		total += w
+		cumulative[j] = total
+	}
+
+	i.ranking = ranking{
+		ids:        ids,
+		weights:    weights,
+		cumulative: cumulative,
+		stored:     stored,
+		ranked:     time.Now(),
+	}
+	return i.ranking
+}
+
+// stored is the number of IDs in the store.
+func (i *IDStore) stored() int {
+	wid := atomic.LoadInt64(&i.writeIDX)
+	if wid >= int64(len(i.ids)) {
+		wid = int64(len(i.ids) - 1)
+	}
+
+	return int(wid + 1)
+}
+
 func shuffle(a []string) {
 	for i := range a {
 		j := rand.Intn(i + 1)
@@ -1,6 +1,7 @@
 package v1_test
 
 import (
+	"time"
 	"volley/v1"
 
 	. "github.com/onsi/ginkgo"
@@ -9,7 +10,7 @@ import (
 
 var _ = Describe("AppIDStore", func() {
 	It("returns an app ID weighted on the number of times it has been added", func() {
-		store := v1.NewIDStore(3)
+		store := v1.NewIDStore(3, 0, v1.NewUniform())
 		store.Add("some-id")
 		store.Add("some-id")
 		store.Add("some-more-id")
@@ -28,7 +29,7 @@ var _ = Describe("AppIDStore", func() {
 	})
 
 	It("blocks until it is full", func() {
-		store := v1.NewIDStore(3)
+		store := v1.NewIDStore(3, 0, v1.NewUniform())
 		store.Add("some-id")
 		store.Add("some-id")
 
@@ -45,8 +46,38 @@ var _ = Describe("AppIDStore", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("returns the IDs it has once the get timeout has passed", func() {
+		store := v1.NewIDStore(3, 100*time.Millisecond, v1.NewUniform())
+		store.Add("some-id")
+
+		done := make(chan string)
+		go func() {
+			done <- store.Get()
+		}()
+
+		Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+		Eventually(done).Should(Receive(Equal("some-id")))
+	})
+
+	It("returns an empty ID after the get timeout when it is empty", func() {
+		store := v1.NewIDStore(3, time.Millisecond, v1.NewUniform())
+
+		Eventually(store.Get).Should(BeEmpty())
+
+		store.Add("some-id")
+		Expect(store.Get()).To(Equal("some-id"))
+	})
+
+	It("can be seeded", func() {
+		store := v1.NewIDStore(3, 0, v1.NewUniform())
+		store.Seed([]string{"some-id-1", "some-id-2", "some-id-2"})
+
+		Expect(store.Get()).To(BeElementOf("some-id-1", "some-id-2"))
+		Expect(store.IDs()).To(ConsistOf("some-id-1", "some-id-2", "some-id-2"))
+	})
+
 	It("can get multiple unique values", func() {
-		store := v1.NewIDStore(3)
+		store := v1.NewIDStore(3, 0, v1.NewUniform())
 		store.Add("some-id-1")
 		store.Add("some-id-2")
 		store.Add("some-id-3")
@@ -59,7 +90,7 @@ var _ = Describe("AppIDStore", func() {
 	})
 
 	It("does not return empty keys requesting more then are available", func() {
-		store := v1.NewIDStore(2)
+		store := v1.NewIDStore(2, 0, v1.NewUniform())
 		store.Add("some-id-1")
 
 		Expect(store.GetN(3)).To(ConsistOf(
@@ -68,12 +99,12 @@ var _ = Describe("AppIDStore", func() {
 	})
 
 	It("returns an empty list with an empty store", func() {
-		store := v1.NewIDStore(2)
+		store := v1.NewIDStore(2, 0, v1.NewUniform())
 		Expect(store.GetN(3)).To(BeEmpty())
 	})
 
 	It("handles more adds then capacity allows", func() {
-		store := v1.NewIDStore(2)
+		store := v1.NewIDStore(2, 0, v1.NewUniform())
 		store.Add("some-id-1")
 		store.Add("some-id-2")
 		store.Add("some-id-3")
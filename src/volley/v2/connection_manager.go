@@ -1,97 +1,264 @@
 package v2
 
 import (
-	"conf"
 	"context"
-	"log"
+	"logging"
 	"math/rand"
+	"net"
+	"strings"
 	"time"
 
+	"volley/profile"
+	"volley/session"
+	"volley/validate"
+
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"github.com/cloudfoundry/dropsonde/metricbatcher"
+	"github.com/golang/protobuf/proto"
 
 	"google.golang.org/grpc"
 )
 
+var logger = logging.New("volley_v2").With("conn_type", "rlp")
+
 type Batcher interface {
 	BatchCounter(name string) metricbatcher.BatchCounterChainer
 }
 
 type ConnectionManager struct {
 	addrs            []string
-	receiveDelay     conf.DurationRange
+	profile          profile.Profile
 	usePreferredTags bool
+	batchedRatio     float64
 	batcher          Batcher
+	validator        *validate.Validator
+	sessions         *session.Registry
 	dialOpts         []grpc.DialOption
 }
 
 // NewConnectionManager manages the gRPC connections to
-// the Loggregator V2 API
+// the Loggregator V2 API. batchedRatio is the fraction of connections
+// that use BatchedReceiver instead of Receiver. Every envelope is checked
+// against its selector by the validator, if any.
 func NewConnectionManager(
 	addrs []string,
-	receiveDelay conf.DurationRange,
+	p profile.Profile,
 	usePreferredTags bool,
+	batchedRatio float64,
 	batcher Batcher,
+	validator *validate.Validator,
+	sessions *session.Registry,
 	dialOpts ...grpc.DialOption,
 ) *ConnectionManager {
 	return &ConnectionManager{
 		addrs:            addrs,
-		receiveDelay:     receiveDelay,
+		profile:          p,
 		usePreferredTags: usePreferredTags,
+		batchedRatio:     batchedRatio,
 		batcher:          batcher,
+		validator:        validator,
+		sessions:         sessions,
 		dialOpts:         dialOpts,
 	}
 }
 
 // Assault repeatedly establishes connections to the Loggregator V2 API
-// and reads from those connections for a random length of time
-func (m *ConnectionManager) Assault(s *loggregator_v2.Selector) {
-	for {
-		m.establishConnection(s)
+// and reads from those connections for a random length of time, as the
+// consumer profile says. Connections that cannot be dialed or opened, or
+// that fail while reading, are retried after a second. Each connection is
+// tracked as a session; closing the session ends that connection and a new one is
+// established. Every selector is sent in the same request, with the shard
+// ID if it is set. It returns once ctx is done.
+func (m *ConnectionManager) Assault(ctx context.Context, shardID string, s []*loggregator_v2.Selector) {
+	for ctx.Err() == nil {
+		if err := m.establishConnection(ctx, shardID, s); err != nil {
+			logger.With("error", err).Errorf("did not connect")
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
 	}
 }
 
-func (m *ConnectionManager) establishConnection(s *loggregator_v2.Selector) {
+func (m *ConnectionManager) establishConnection(ctx context.Context, shardID string, s []*loggregator_v2.Selector) error {
 	addr := m.addrs[rand.Intn(len(m.addrs))]
-	conn, err := grpc.Dial(addr, m.dialOpts...)
+	dialOpts := m.dialOpts
+	if d, ok := m.profile.(profile.Dialer); ok {
+		dialOpts = append(dialOpts[:len(dialOpts):len(dialOpts)], grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return d.Dial("tcp", addr, timeout)
+		}))
+	}
+	conn, err := grpc.Dial(addr, dialOpts...)
 	if err != nil {
-		log.Fatalf("did not connect: %s", err)
+		return err
 	}
 	defer conn.Close()
 	c := loggregator_v2.NewEgressClient(conn)
 
-	ctx, _ := context.WithTimeout(context.Background(), time.Minute+(time.Duration(rand.Intn(30000))*time.Millisecond))
+	target := shardID
+	if target == "" {
+		target = sourceIDs(s)
+	}
+	sess := m.sessions.Open(ctx, sessionType(s), target)
+	defer sess.Close()
+
+	ctx, cancel := context.WithTimeout(sess.Context(), time.Minute+(time.Duration(rand.Intn(30000))*time.Millisecond))
+	defer cancel()
+	if rand.Float64() < m.batchedRatio {
+		r, err := c.BatchedReceiver(ctx, &loggregator_v2.EgressBatchRequest{
+			ShardId:          shardID,
+			UsePreferredTags: m.usePreferredTags,
+			Selectors:        s,
+		})
+		if err != nil {
+			logger.With("addr", addr).With("error", err).Warnf("could not receive batched stream")
+			return err
+		}
+
+		return m.connectBatched(ctx, shardID, s, r)
+	}
+
 	r, err := c.Receiver(ctx, &loggregator_v2.EgressRequest{
+		ShardId:          shardID,
 		UsePreferredTags: m.usePreferredTags,
-		Selectors: []*loggregator_v2.Selector{
-			s,
-		},
+		Selectors:        s,
 	})
 	if err != nil {
-		log.Printf("could not receive stream: %s", err)
-		return
+		logger.With("addr", addr).With("error", err).Warnf("could not receive stream")
+		return err
+	}
+
+	return m.connect(ctx, shardID, s, r)
+}
+
+// sessionType names the kind of connection the selectors make, matching the
+// names of EgressV2's pools.
+func sessionType(s []*loggregator_v2.Selector) string {
+	if len(s) > 1 {
+		return "v2_multi_source_stream"
+	}
+
+	var sel *loggregator_v2.Selector
+	if len(s) == 1 {
+		sel = s[0]
+	}
+
+	switch sel.GetMessage().(type) {
+	case *loggregator_v2.Selector_Counter:
+		return "v2_counter_stream"
+	case *loggregator_v2.Selector_Gauge:
+		return "v2_gauge_stream"
+	case *loggregator_v2.Selector_Timer:
+		return "v2_timer_stream"
+	case *loggregator_v2.Selector_Event:
+		return "v2_event_stream"
+	}
+
+	switch {
+	case sel.GetSourceId() == "":
+		return "v2_firehose"
+	case sel.GetLog() != nil:
+		return "v2_app_log_stream"
+	default:
+		return "v2_app_stream"
+	}
+}
+
+func sourceIDs(s []*loggregator_v2.Selector) string {
+	ids := make([]string, 0, len(s))
+	for _, sel := range s {
+		if sel.GetSourceId() != "" {
+			ids = append(ids, sel.GetSourceId())
+		}
 	}
 
-	m.connect(r)
+	return strings.Join(ids, ",")
 }
 
-func (m *ConnectionManager) connect(r loggregator_v2.Egress_ReceiverClient) {
-	delta := int(m.receiveDelay.Max - m.receiveDelay.Min)
+// connect reads envelopes until the stream ends. It returns the error that
+// ended the stream unless ctx is done.
+func (m *ConnectionManager) connect(ctx context.Context, shardID string, s []*loggregator_v2.Selector, r loggregator_v2.Egress_ReceiverClient) error {
+	pacer := m.profile.NewPacer()
+	connType := sessionType(s)
 	var count int
 	for {
-		_, err := r.Recv()
+		e, err := r.Recv()
 		if err != nil {
-			return
+			return streamErr(ctx, err)
 		}
 
 		count++
 		if count%1000 == 0 {
-			m.batcher.BatchCounter("volley.receivedEnvelopes").SetTag("version", "v2").Add(1000)
+			m.receivedEnvelopes("receiver", shardID).Add(1000)
+		}
+		m.validator.V2(connType, s, e)
+		pacer.Wait(ctx, proto.Size(e))
+	}
+}
+
+// connectBatched reads batches until the stream ends, counting the
+// envelopes and the batches by size. The profile paces every envelope of a
+// batch. Like connect, it returns the error that ended the stream.
+func (m *ConnectionManager) connectBatched(ctx context.Context, shardID string, s []*loggregator_v2.Selector, r loggregator_v2.Egress_BatchedReceiverClient) error {
+	pacer := m.profile.NewPacer()
+	connType := sessionType(s)
+	for {
+		b, err := r.Recv()
+		if err != nil {
+			return streamErr(ctx, err)
 		}
-		if delta == 0 {
-			continue
+
+		batch := b.GetBatch()
+		m.receivedEnvelopes("batched_receiver", shardID).Add(uint64(len(batch)))
+		m.batcher.BatchCounter("volley.receivedBatches").
+			SetTag("size", batchSize(len(batch))).
+			Increment()
+
+		for _, e := range batch {
+			m.validator.V2(connType, s, e)
+			pacer.Wait(ctx, proto.Size(e))
 		}
-		delay := m.receiveDelay.Min + time.Duration(rand.Intn(delta))
-		time.Sleep(delay)
+	}
+}
+
+// streamErr ignores the error that ended a stream when the stream was
+// ended by its context, i.e. its session was closed or timed out.
+func streamErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// receivedEnvelopes counts envelopes by RPC and, for firehoses, by shard
+// group.
+func (m *ConnectionManager) receivedEnvelopes(rpc, shardID string) metricbatcher.BatchCounterChainer {
+	c := m.batcher.BatchCounter("volley.receivedEnvelopes").
+		SetTag("version", "v2").
+		SetTag("rpc", rpc)
+	if shardID != "" {
+		c = c.SetTag("shard_id", shardID)
+	}
+
+	return c
+}
+
+// batchSize buckets the number of envelopes in a batch so that
+// volley.receivedBatches shows how full the batches are.
+func batchSize(n int) string {
+	switch {
+	case n <= 1:
+		return "1"
+	case n <= 10:
+		return "2-10"
+	case n <= 100:
+		return "11-100"
+	case n <= 1000:
+		return "101-1000"
+	default:
+		return "1001+"
 	}
 }
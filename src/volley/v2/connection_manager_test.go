@@ -1,16 +1,23 @@
 package v2_test
 
 import (
+	"bytes"
 	"conf"
+	"context"
 	"errors"
 	"log"
+	"metrics"
 	"net"
+	"sync"
+	"volley/control"
+	"volley/profile"
+	"volley/session"
 	"volley/v2"
+	"volley/validate"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"github.com/cloudfoundry/dropsonde/metricbatcher"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -18,11 +25,13 @@ import (
 
 var _ = Describe("ConnectionManager", func() {
 	var (
-		reqs    chan *loggregator_v2.EgressRequest
-		addrs   []string
-		spies   []*spyLoggregator
-		c       *v2.ConnectionManager
-		batcher *spyBatcher
+		reqs     chan *loggregator_v2.EgressRequest
+		addrs    []string
+		spies    []*spyLoggregator
+		c        *v2.ConnectionManager
+		batcher  *spyBatcher
+		gauges   *metrics.Registry
+		sessions *session.Registry
 	)
 
 	BeforeEach(func() {
@@ -37,7 +46,18 @@ var _ = Describe("ConnectionManager", func() {
 			addrs = append(addrs, addr)
 			spies = append(spies, spy)
 		}
-		c = v2.NewConnectionManager(addrs, conf.DurationRange{}, true, batcher, grpc.WithInsecure())
+		gauges = metrics.NewRegistry()
+		sessions = session.NewRegistry(gauges, batcher)
+		c = v2.NewConnectionManager(
+			addrs,
+			profile.NewUniform(control.NewDelay(conf.DurationRange{})),
+			true,
+			0,
+			batcher,
+			nil,
+			sessions,
+			grpc.WithInsecure(),
+		)
 	})
 
 	Context("without an error", func() {
@@ -49,7 +69,7 @@ var _ = Describe("ConnectionManager", func() {
 
 		It("connects to RLP with the given selector", func() {
 			f := &loggregator_v2.Selector{SourceId: "some-id"}
-			go c.Assault(f)
+			go c.Assault(context.Background(), "", []*loggregator_v2.Selector{f})
 
 			var req *loggregator_v2.EgressRequest
 			Eventually(reqs).Should(Receive(&req))
@@ -57,15 +77,155 @@ var _ = Describe("ConnectionManager", func() {
 			Expect(req.UsePreferredTags).To(BeTrue())
 		})
 
+		It("sends the shard ID", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.Assault(ctx, "some-shard", []*loggregator_v2.Selector{{}})
+
+			var req *loggregator_v2.EgressRequest
+			Eventually(reqs).Should(Receive(&req))
+			Expect(req.ShardId).To(Equal("some-shard"))
+		})
+
+		It("sends several selectors in one request", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			f := []*loggregator_v2.Selector{{SourceId: "some-id"}, {SourceId: "other-id"}}
+			go c.Assault(ctx, "", f)
+
+			var req *loggregator_v2.EgressRequest
+			Eventually(reqs).Should(Receive(&req))
+			Expect(req.GetSelectors()).To(Equal(f))
+			Eventually(func() string {
+				var b bytes.Buffer
+				gauges.WriteTo(&b)
+				return b.String()
+			}).Should(ContainSubstring(`volley_openSessions{conn_type="v2_multi_source_stream"}`))
+		})
+
 		It("makes a request to every RLP", func() {
 			for i := 0; i < 10; i++ {
 				f := &loggregator_v2.Selector{SourceId: "some-id"}
-				go c.Assault(f)
+				go c.Assault(context.Background(), "", []*loggregator_v2.Selector{f})
 			}
 
+			// Connections that end are retried a second later on a random
+			// RLP, so allow for a few retries.
 			for _, spy := range spies {
-				Eventually(spy.receiverCalled).Should(Receive())
+				Eventually(spy.receiverCalled, 5).Should(Receive())
+			}
+		})
+
+		It("tracks each connection as a session", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			f := &loggregator_v2.Selector{
+				SourceId: "some-id",
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			}
+			go c.Assault(ctx, "", []*loggregator_v2.Selector{f})
+
+			Eventually(reqs).Should(Receive())
+			Eventually(func() string {
+				var b bytes.Buffer
+				gauges.WriteTo(&b)
+				return b.String()
+			}).Should(ContainSubstring(`volley_openSessions{conn_type="v2_app_log_stream"}`))
+
+			cancel()
+			Eventually(func() int { return sessions.Count("v2_app_log_stream") }).Should(Equal(0))
+		})
+
+		It("stops once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.Assault(ctx, "", []*loggregator_v2.Selector{{}})
+			}()
+
+			Eventually(reqs).Should(Receive())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("with BatchedReceiver", func() {
+		BeforeEach(func() {
+			for _, s := range spies {
+				close(s.errs)
 			}
+			c = v2.NewConnectionManager(
+				addrs,
+				profile.NewUniform(control.NewDelay(conf.DurationRange{})),
+				true,
+				1,
+				batcher,
+				nil,
+				sessions,
+				grpc.WithInsecure(),
+			)
+		})
+
+		It("connects to RLP with the given selector", func() {
+			f := &loggregator_v2.Selector{SourceId: "some-id"}
+			go c.Assault(context.Background(), "", []*loggregator_v2.Selector{f})
+
+			var req *loggregator_v2.EgressBatchRequest
+			Eventually(batchReqs(spies)).Should(Receive(&req))
+			Expect(req.GetSelectors()[0]).To(Equal(f))
+			Expect(req.UsePreferredTags).To(BeTrue())
+			Consistently(reqs).ShouldNot(Receive())
+		})
+
+		It("counts the envelopes of each shard group", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.Assault(ctx, "some-shard", []*loggregator_v2.Selector{{}})
+
+			var req *loggregator_v2.EgressBatchRequest
+			Eventually(batchReqs(spies)).Should(Receive(&req))
+			Expect(req.ShardId).To(Equal("some-shard"))
+			Eventually(func() uint64 {
+				return batcher.count("volley.receivedEnvelopes", "shard_id", "some-shard")
+			}).Should(BeNumerically(">=", 5))
+		})
+
+		It("validates each envelope against its selector", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			validator := validate.NewValidator(batcher, 1)
+			c = v2.NewConnectionManager(
+				addrs,
+				profile.NewUniform(control.NewDelay(conf.DurationRange{})),
+				true,
+				1,
+				batcher,
+				validator,
+				sessions,
+				grpc.WithInsecure(),
+			)
+			go c.Assault(ctx, "", []*loggregator_v2.Selector{{SourceId: "a"}})
+
+			Eventually(func() uint64 {
+				return batcher.count("volley.envelopeViolations", "reason", "source_id")
+			}).Should(BeNumerically(">=", 4))
+			Expect(validator.Violations()).To(BeNumerically(">=", 4))
+		})
+
+		It("counts the envelopes and batches by size", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.Assault(ctx, "", []*loggregator_v2.Selector{{}})
+
+			Eventually(func() uint64 {
+				return batcher.count("volley.receivedEnvelopes", "rpc", "batched_receiver")
+			}).Should(BeNumerically(">=", 5))
+			Eventually(func() uint64 {
+				return batcher.count("volley.receivedBatches", "size", "2-10")
+			}).Should(BeNumerically(">=", 1))
 		})
 	})
 
@@ -77,13 +237,54 @@ var _ = Describe("ConnectionManager", func() {
 			}
 		})
 		It("retries on an error", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
 			f := &loggregator_v2.Selector{SourceId: "some-id"}
-			go c.Assault(f)
+			go c.Assault(ctx, "", []*loggregator_v2.Selector{f})
 
+			Eventually(func() int { return receiverCalls(spies) }, 3).Should(BeNumerically(">", 1))
+		})
+	})
+
+	Context("when every request fails", func() {
+		BeforeEach(func() {
 			for _, s := range spies {
-				Eventually(func() int { return len(s.receiverCalled) }).Should(BeNumerically(">", 1))
+				for i := 0; i < cap(s.errs); i++ {
+					s.errs <- errors.New("some-error")
+				}
 			}
 		})
+
+		It("waits before retrying", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.Assault(ctx, "", []*loggregator_v2.Selector{{}})
+
+			Eventually(func() int { return receiverCalls(spies) }).Should(Equal(1))
+			Consistently(func() int { return receiverCalls(spies) }, "700ms").Should(Equal(1))
+			Eventually(func() int { return receiverCalls(spies) }).Should(Equal(2))
+		})
+
+		It("waits before retrying batched requests", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c = v2.NewConnectionManager(
+				addrs,
+				profile.NewUniform(control.NewDelay(conf.DurationRange{})),
+				true,
+				1,
+				batcher,
+				nil,
+				sessions,
+				grpc.WithInsecure(),
+			)
+			reqs := batchReqs(spies)
+			go c.Assault(ctx, "", []*loggregator_v2.Selector{{}})
+
+			Eventually(reqs).Should(Receive())
+			Consistently(reqs, "700ms").ShouldNot(Receive())
+			Eventually(reqs).Should(Receive())
+		})
 	})
 })
 
@@ -91,6 +292,31 @@ type spyLoggregator struct {
 	receiverCalled chan bool
 	errs           chan error
 	reqs           chan *loggregator_v2.EgressRequest
+	batchReqs      chan *loggregator_v2.EgressBatchRequest
+}
+
+// receiverCalls counts the Receiver requests made to every spy.
+func receiverCalls(spies []*spyLoggregator) int {
+	var n int
+	for _, s := range spies {
+		n += len(s.receiverCalled)
+	}
+
+	return n
+}
+
+// batchReqs merges the BatchedReceiver requests made to every spy.
+func batchReqs(spies []*spyLoggregator) chan *loggregator_v2.EgressBatchRequest {
+	reqs := make(chan *loggregator_v2.EgressBatchRequest, 100)
+	for _, s := range spies {
+		go func(s *spyLoggregator) {
+			for r := range s.batchReqs {
+				reqs <- r
+			}
+		}(s)
+	}
+
+	return reqs
 }
 
 func startSpyLoggregator(reqs chan *loggregator_v2.EgressRequest) (*spyLoggregator, string) {
@@ -103,6 +329,7 @@ func startSpyLoggregator(reqs chan *loggregator_v2.EgressRequest) (*spyLoggregat
 		reqs:           reqs,
 		receiverCalled: make(chan bool, 100),
 		errs:           make(chan error, 100),
+		batchReqs:      make(chan *loggregator_v2.EgressBatchRequest, 100),
 	}
 
 	s := grpc.NewServer()
@@ -129,16 +356,70 @@ func (s *spyLoggregator) BatchedReceiver(
 	req *loggregator_v2.EgressBatchRequest,
 	rx loggregator_v2.Egress_BatchedReceiverServer,
 ) error {
-	return grpc.Errorf(codes.Unimplemented, "Not yet implemented")
+	s.batchReqs <- req
+	err := rx.Send(&loggregator_v2.EnvelopeBatch{
+		Batch: []*loggregator_v2.Envelope{
+			{SourceId: "a"}, {SourceId: "b"}, {SourceId: "c"}, {SourceId: "d"}, {SourceId: "e"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return <-s.errs
+}
+
+type spyBatcher struct {
+	mu     sync.Mutex
+	counts []spyCount
+}
+
+type spyCount struct {
+	name  string
+	tags  map[string]string
+	value uint64
+}
+
+func (s *spyBatcher) BatchCounter(name string) metricbatcher.BatchCounterChainer {
+	return &spyChainer{
+		batcher: s,
+		count:   spyCount{name: name, tags: make(map[string]string)},
+	}
+}
+
+// count sums the counters with the name that have the tag.
+func (s *spyBatcher) count(name, key, value string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total uint64
+	for _, c := range s.counts {
+		if c.name == name && c.tags[key] == value {
+			total += c.value
+		}
+	}
+
+	return total
 }
 
-type spyBatcher struct{}
+type spyChainer struct {
+	batcher *spyBatcher
+	count   spyCount
+}
+
+func (c *spyChainer) SetTag(key, value string) metricbatcher.BatchCounterChainer {
+	c.count.tags[key] = value
+	return c
+}
 
-func (s *spyBatcher) BatchCounter(string) metricbatcher.BatchCounterChainer {
-	return s
+func (c *spyChainer) Increment() {
+	c.Add(1)
 }
-func (s *spyBatcher) SetTag(string, string) metricbatcher.BatchCounterChainer {
-	return s
+
+func (c *spyChainer) Add(value uint64) {
+	c.batcher.mu.Lock()
+	defer c.batcher.mu.Unlock()
+
+	c.count.value = value
+	c.batcher.counts = append(c.batcher.counts, c.count)
 }
-func (s *spyBatcher) Add(uint64) {}
-func (s *spyBatcher) Increment() {}
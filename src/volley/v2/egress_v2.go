@@ -1,11 +1,17 @@
 package v2
 
 import (
+	"context"
+
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	"volley/control"
+	"volley/scenario"
+	"volley/shard"
 )
 
 type Assaulter interface {
-	Assault(filter *loggregator_v2.Selector)
+	Assault(ctx context.Context, shardID string, selectors []*loggregator_v2.Selector)
 }
 
 type IDGetter interface {
@@ -15,52 +21,152 @@ type IDGetter interface {
 // EgressV2 initiates the configured number of connections to Loggregator's V2
 // API and uses the Assaulter to simulate hostile consumers
 type EgressV2 struct {
-	connManager   Assaulter
-	idStore       IDGetter
-	firehoses     int
-	appStreams    int
-	appLogStreams int
+	phases        []scenario.Phase
+	receiveDelay  *control.Delay
+	firehoses     *control.Pool
+	appStreams    *control.Pool
+	appLogStreams *control.Pool
+	counters      *control.Pool
+	gauges        *control.Pool
+	timers        *control.Pool
+	events        *control.Pool
+	multiSources  *control.Pool
 }
 
-// NewEgressV2 creates a new EgressV2 with a configurable number of firehose
-// connections, app streams, and app log streams
+// NewEgressV2 creates a new EgressV2 which steps through the phases, each
+// with its own number of connections with each kind of selector. Firehose
+// connections are spread across the shard groups, and send no shard ID
+// unless shard group weights were given. Counter,
+// gauge, timer and event streams select their type of envelope from every
+// source, filtered by counterName and gaugeNames when set. Multi-source
+// streams select sourcesPerRequest app sources in a single request.
 func NewEgressV2(
 	c Assaulter,
 	s IDGetter,
-	firehoseCount int,
-	appStreamCount int,
-	appLogStreamCount int,
+	shards *shard.Groups,
+	receiveDelay *control.Delay,
+	counterName string,
+	gaugeNames []string,
+	sourcesPerRequest int,
+	phases []scenario.Phase,
 ) *EgressV2 {
-	return &EgressV2{
-		connManager:   c,
-		idStore:       s,
-		firehoses:     firehoseCount,
-		appStreams:    appStreamCount,
-		appLogStreams: appLogStreamCount,
+	// A connection is not opened when its selectors are nil, e.g. while no
+	// app IDs are known, and the pool retries it later.
+	assault := func(selectors func() []*loggregator_v2.Selector) *control.Pool {
+		return control.NewPool(func(ctx context.Context) {
+			if s := selectors(); s != nil {
+				c.Assault(ctx, "", s)
+			}
+		})
 	}
-}
 
-func (e *EgressV2) Start() {
-	firehoseFilter := &loggregator_v2.Selector{}
-
-	for i := 0; i < e.firehoses; i++ {
-		go e.connManager.Assault(firehoseFilter)
+	shardID := func() string { return "" }
+	if shards.Sharded() {
+		shardID = shards.Pick
 	}
 
-	for i := 0; i < e.appStreams; i++ {
-		f := &loggregator_v2.Selector{
-			SourceId: e.idStore.Get(),
-		}
-		go e.connManager.Assault(f)
+	return &EgressV2{
+		phases:       phases,
+		receiveDelay: receiveDelay,
+		firehoses: control.NewPool(func(ctx context.Context) {
+			c.Assault(ctx, shardID(), []*loggregator_v2.Selector{{}})
+		}),
+		appStreams: assault(func() []*loggregator_v2.Selector {
+			id := s.Get()
+			if id == "" {
+				return nil
+			}
+			return []*loggregator_v2.Selector{{SourceId: id}}
+		}),
+		appLogStreams: assault(func() []*loggregator_v2.Selector {
+			id := s.Get()
+			if id == "" {
+				return nil
+			}
+			return []*loggregator_v2.Selector{{
+				SourceId: id,
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			}}
+		}),
+		counters: assault(func() []*loggregator_v2.Selector {
+			return []*loggregator_v2.Selector{{
+				Message: &loggregator_v2.Selector_Counter{
+					Counter: &loggregator_v2.CounterSelector{Name: counterName},
+				},
+			}}
+		}),
+		gauges: assault(func() []*loggregator_v2.Selector {
+			return []*loggregator_v2.Selector{{
+				Message: &loggregator_v2.Selector_Gauge{
+					Gauge: &loggregator_v2.GaugeSelector{Names: gaugeNames},
+				},
+			}}
+		}),
+		timers: assault(func() []*loggregator_v2.Selector {
+			return []*loggregator_v2.Selector{{
+				Message: &loggregator_v2.Selector_Timer{
+					Timer: &loggregator_v2.TimerSelector{},
+				},
+			}}
+		}),
+		events: assault(func() []*loggregator_v2.Selector {
+			return []*loggregator_v2.Selector{{
+				Message: &loggregator_v2.Selector_Event{
+					Event: &loggregator_v2.EventSelector{},
+				},
+			}}
+		}),
+		multiSources: assault(func() []*loggregator_v2.Selector {
+			selectors := make([]*loggregator_v2.Selector, 0, sourcesPerRequest)
+			for i := 0; i < sourcesPerRequest; i++ {
+				id := s.Get()
+				if id == "" {
+					return nil
+				}
+				selectors = append(selectors, &loggregator_v2.Selector{SourceId: id})
+			}
+			return selectors
+		}),
 	}
+}
 
-	for i := 0; i < e.appLogStreams; i++ {
-		f := &loggregator_v2.Selector{
-			SourceId: e.idStore.Get(),
-			Message: &loggregator_v2.Selector_Log{
-				Log: &loggregator_v2.LogSelector{},
-			},
-		}
-		go e.connManager.Assault(f)
+// Pools returns the connections of each type so they can be controlled
+// while volley is running.
+func (e *EgressV2) Pools() map[string]*control.Pool {
+	return map[string]*control.Pool{
+		"v2_firehose":            e.firehoses,
+		"v2_app_stream":          e.appStreams,
+		"v2_app_log_stream":      e.appLogStreams,
+		"v2_counter_stream":      e.counters,
+		"v2_gauge_stream":        e.gauges,
+		"v2_timer_stream":        e.timers,
+		"v2_event_stream":        e.events,
+		"v2_multi_source_stream": e.multiSources,
 	}
 }
+
+// Start steps through the phases, scaling the connections of each type to
+// the phase's mix. Every connection is closed once the last phase is over.
+func (e *EgressV2) Start() {
+	scenario.Run(context.Background(), e.phases, e.startPhase)
+	e.scale(scenario.V2Mix{})
+}
+
+func (e *EgressV2) startPhase(_ context.Context, p scenario.Phase) {
+	logger.With("phase", p.Name).Infof("Starting V2 phase")
+	e.receiveDelay.Set(p.ReceiveDelay)
+	e.scale(p.V2)
+}
+
+func (e *EgressV2) scale(m scenario.V2Mix) {
+	e.firehoses.Scale(m.Firehose)
+	e.appStreams.Scale(m.AppStream)
+	e.appLogStreams.Scale(m.AppLogStream)
+	e.counters.Scale(m.CounterStream)
+	e.gauges.Scale(m.GaugeStream)
+	e.timers.Scale(m.TimerStream)
+	e.events.Scale(m.EventStream)
+	e.multiSources.Scale(m.MultiSourceStream)
+}
@@ -1,9 +1,15 @@
 package v2_test
 
 import (
+	"conf"
+	"context"
 	"math/rand"
 	"sync"
+	"time"
 
+	"volley/control"
+	"volley/scenario"
+	"volley/shard"
 	"volley/v2"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
@@ -16,12 +22,37 @@ var _ = Describe("EgressV2", func() {
 	It("opens specified number of firehose conns to RLP", func() {
 		connectionManager := &spyConnManager{}
 		store := &spyIDStore{}
-		egress := v2.NewEgressV2(connectionManager, store, 10, 0, 0)
+		egress := v2.NewEgressV2(connectionManager, store, newShards(), newDelay(), "", nil, 3, phase(10, 0, 0))
 		go egress.Start()
 
 		Eventually(connectionManager.FirehoseCount).Should(Equal(10))
 	})
 
+	It("sends no shard ID without shard groups", func() {
+		connectionManager := &spyConnManager{}
+		egress := v2.NewEgressV2(connectionManager, &spyIDStore{}, newShards(), newDelay(), "", nil, 3, phase(10, 0, 0))
+		go egress.Start()
+
+		Eventually(connectionManager.ShardIDs).Should(HaveLen(10))
+		Expect(connectionManager.ShardIDs()).To(ConsistOf(make([]string, 10)))
+	})
+
+	It("spreads firehose conns across the shard groups", func() {
+		connectionManager := &spyConnManager{}
+		store := &spyIDStore{appIDs: []string{"app-id-1"}}
+		shards, err := shard.NewGroups("some-sub-id", []int{1, 1})
+		Expect(err).ToNot(HaveOccurred())
+		egress := v2.NewEgressV2(connectionManager, store, shards, newDelay(), "", nil, 3, phase(20, 5, 0))
+		go egress.Start()
+
+		Eventually(connectionManager.FirehoseCount).Should(Equal(20))
+		Eventually(connectionManager.ShardIDs).Should(HaveLen(25))
+		Expect(connectionManager.ShardIDs()).To(ContainElement("some-sub-id-0"))
+		Expect(connectionManager.ShardIDs()).To(ContainElement("some-sub-id-1"))
+		Expect(connectionManager.ShardIDs()).To(ContainElement(""))
+		Expect(connectionManager.ShardIDs()).ToNot(ContainElement("some-sub-id"))
+	})
+
 	Context("when the selectors specifes source id", func() {
 		It("opens app streams using available appIDs", func() {
 			availableApps := []string{"app-id-1", "app-id-2"}
@@ -29,7 +60,7 @@ var _ = Describe("EgressV2", func() {
 				appIDs: availableApps,
 			}
 			connectionManager := &spyConnManager{}
-			egress := v2.NewEgressV2(connectionManager, idStore, 0, 3, 0)
+			egress := v2.NewEgressV2(connectionManager, idStore, newShards(), newDelay(), "", nil, 3, phase(0, 3, 0))
 			go egress.Start()
 
 			f := func() int {
@@ -46,7 +77,7 @@ var _ = Describe("EgressV2", func() {
 				appIDs: availableApps,
 			}
 			connectionManager := &spyConnManager{}
-			egress := v2.NewEgressV2(connectionManager, idStore, 0, 0, 7)
+			egress := v2.NewEgressV2(connectionManager, idStore, newShards(), newDelay(), "", nil, 3, phase(0, 0, 7))
 			go egress.Start()
 
 			f := func() int {
@@ -55,8 +86,158 @@ var _ = Describe("EgressV2", func() {
 			Eventually(f).Should(Equal(7))
 		})
 	})
+
+	Context("when the selectors are for other envelope types", func() {
+		It("opens counter, gauge, timer and event streams", func() {
+			connectionManager := &spyConnManager{}
+			phases := []scenario.Phase{
+				{
+					V2: scenario.V2Mix{
+						CounterStream: 1,
+						GaugeStream:   2,
+						TimerStream:   3,
+						EventStream:   4,
+					},
+				},
+			}
+			egress := v2.NewEgressV2(
+				connectionManager,
+				&spyIDStore{},
+				newShards(),
+				newDelay(),
+				"some-counter",
+				[]string{"cpu", "memory"},
+				3,
+				phases,
+			)
+			go egress.Start()
+
+			Eventually(func() int {
+				return connectionManager.TypeCount(func(f *loggregator_v2.Selector) bool {
+					return f.GetCounter().GetName() == "some-counter"
+				})
+			}).Should(Equal(1))
+			Eventually(func() int {
+				return connectionManager.TypeCount(func(f *loggregator_v2.Selector) bool {
+					return f.GetGauge() != nil && len(f.GetGauge().GetNames()) == 2
+				})
+			}).Should(Equal(2))
+			Eventually(func() int {
+				return connectionManager.TypeCount(func(f *loggregator_v2.Selector) bool {
+					return f.GetTimer() != nil
+				})
+			}).Should(Equal(3))
+			Eventually(func() int {
+				return connectionManager.TypeCount(func(f *loggregator_v2.Selector) bool {
+					return f.GetEvent() != nil
+				})
+			}).Should(Equal(4))
+			Expect(connectionManager.FirehoseCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the request has several source IDs", func() {
+		It("opens multi-source streams", func() {
+			connectionManager := &spyConnManager{}
+			idStore := &spyIDStore{appIDs: []string{"app-id-1", "app-id-2"}}
+			phases := []scenario.Phase{
+				{V2: scenario.V2Mix{MultiSourceStream: 2}},
+			}
+			egress := v2.NewEgressV2(connectionManager, idStore, newShards(), newDelay(), "", nil, 4, phases)
+			go egress.Start()
+
+			Eventually(connectionManager.Requests).Should(HaveLen(2))
+			for _, r := range connectionManager.Requests() {
+				Expect(r).To(HaveLen(4))
+				for _, f := range r {
+					Expect(idStore.appIDs).To(ContainElement(f.GetSourceId()))
+				}
+			}
+		})
+	})
+
+	Context("with several phases", func() {
+		It("scales the connections to each phase in turn", func() {
+			connectionManager := &spyConnManager{}
+			idStore := &spyIDStore{appIDs: []string{"app-id-1"}}
+			receiveDelay := newDelay()
+			phases := []scenario.Phase{
+				{
+					Name:         "ramp-up",
+					Duration:     500 * time.Millisecond,
+					V2:           scenario.V2Mix{Firehose: 2},
+					ReceiveDelay: conf.DurationRange{Min: time.Millisecond, Max: 2 * time.Millisecond},
+				},
+				{
+					Name: "steady",
+					V2:   scenario.V2Mix{Firehose: 5},
+				},
+			}
+			egress := v2.NewEgressV2(connectionManager, idStore, newShards(), receiveDelay, "", nil, 3, phases)
+			go egress.Start()
+
+			Eventually(connectionManager.FirehoseCount).Should(Equal(2))
+			Consistently(connectionManager.FirehoseCount, 100*time.Millisecond).Should(Equal(2))
+			Expect(receiveDelay.Range()).To(Equal(phases[0].ReceiveDelay))
+
+			Eventually(connectionManager.FirehoseCount).Should(Equal(5))
+			Expect(receiveDelay.Range()).To(Equal(conf.DurationRange{}))
+		})
+
+		It("closes the connections once the last phase is over", func() {
+			connectionManager := &spyConnManager{}
+			phases := []scenario.Phase{
+				{Duration: 50 * time.Millisecond, V2: scenario.V2Mix{Firehose: 3}},
+			}
+			egress := v2.NewEgressV2(connectionManager, &spyIDStore{}, newShards(), newDelay(), "", nil, 3, phases)
+			go egress.Start()
+
+			Eventually(connectionManager.FirehoseCount).Should(Equal(3))
+			Eventually(connectionManager.DoneCount).Should(Equal(3))
+		})
+	})
+
+	It("exposes a pool for each type of connection", func() {
+		connectionManager := &spyConnManager{}
+		egress := v2.NewEgressV2(connectionManager, &spyIDStore{}, newShards(), newDelay(), "", nil, 3, phase(0, 0, 0))
+
+		pools := egress.Pools()
+		Expect(pools).To(HaveKey("v2_firehose"))
+		Expect(pools).To(HaveKey("v2_app_stream"))
+		Expect(pools).To(HaveKey("v2_app_log_stream"))
+		Expect(pools).To(HaveKey("v2_counter_stream"))
+		Expect(pools).To(HaveKey("v2_gauge_stream"))
+		Expect(pools).To(HaveKey("v2_timer_stream"))
+		Expect(pools).To(HaveKey("v2_event_stream"))
+		Expect(pools).To(HaveKey("v2_multi_source_stream"))
+
+		pools["v2_firehose"].Scale(4)
+		Eventually(connectionManager.FirehoseCount).Should(Equal(4))
+	})
 })
 
+func newDelay() *control.Delay {
+	return control.NewDelay(conf.DurationRange{})
+}
+
+func newShards() *shard.Groups {
+	g, err := shard.NewGroups("some-sub-id", nil)
+	Expect(err).ToNot(HaveOccurred())
+	return g
+}
+
+func phase(firehoses, appStreams, appLogStreams int) []scenario.Phase {
+	return []scenario.Phase{
+		{
+			V2: scenario.V2Mix{
+				Firehose:     firehoses,
+				AppStream:    appStreams,
+				AppLogStream: appLogStreams,
+			},
+		},
+	}
+}
+
 type spyIDStore struct {
 	appIDs []string
 }
@@ -70,14 +251,61 @@ func (s *spyIDStore) Get() string {
 
 type spyConnManager struct {
 	selectors []*loggregator_v2.Selector
+	requests  [][]*loggregator_v2.Selector
+	shardIDs  []string
+	done      int
 	mu        sync.Mutex
 }
 
-func (s *spyConnManager) Assault(selector *loggregator_v2.Selector) {
+func (s *spyConnManager) Assault(ctx context.Context, shardID string, selectors []*loggregator_v2.Selector) {
+	s.mu.Lock()
+	s.shardIDs = append(s.shardIDs, shardID)
+	s.requests = append(s.requests, selectors)
+	if len(selectors) == 1 {
+		s.selectors = append(s.selectors, selectors[0])
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done++
+}
+
+func (s *spyConnManager) Requests() [][]*loggregator_v2.Selector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([][]*loggregator_v2.Selector(nil), s.requests...)
+}
+
+func (s *spyConnManager) TypeCount(match func(*loggregator_v2.Selector) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+	for _, f := range s.selectors {
+		if match(f) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *spyConnManager) ShardIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.shardIDs...)
+}
+
+func (s *spyConnManager) DoneCount() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.selectors = append(s.selectors, selector)
+	return s.done
 }
 
 func (s *spyConnManager) FirehoseCount() int {
@@ -3,6 +3,7 @@ package v2_test
 import (
 	"io/ioutil"
 	"log"
+	"logging"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -14,6 +15,7 @@ import (
 func TestV2(t *testing.T) {
 	grpclog.SetLogger(log.New(ioutil.Discard, "", 0))
 	log.SetOutput(ioutil.Discard)
+	logging.SetOutput(ioutil.Discard)
 
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "V2 Suite")
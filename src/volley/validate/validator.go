@@ -0,0 +1,165 @@
+// Package validate checks that the envelopes volley receives are the ones
+// it asked for, so that selector leaks in RLP and TrafficController are
+// caught as well as load problems.
+package validate
+
+import (
+	"fmt"
+	"logging"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/dropsonde/envelope_extensions"
+	"github.com/cloudfoundry/dropsonde/metricbatcher"
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+var logger = logging.New("volley_validate")
+
+type Batcher interface {
+	BatchCounter(name string) metricbatcher.BatchCounterChainer
+}
+
+// Validator counts every envelope that does not match its request as a
+// volley.envelopeViolations and logs one in every logEvery of them. A nil
+// Validator accepts every envelope.
+type Validator struct {
+	batcher    Batcher
+	logEvery   uint64
+	violations uint64
+}
+
+func NewValidator(b Batcher, logEvery int) *Validator {
+	if logEvery < 1 {
+		logEvery = 1
+	}
+
+	return &Validator{
+		batcher:  b,
+		logEvery: uint64(logEvery),
+	}
+}
+
+// V1Stream checks that an envelope from the app stream of appID belongs to
+// that app.
+func (v *Validator) V1Stream(appID string, e *events.Envelope) bool {
+	if v == nil {
+		return true
+	}
+
+	got := envelope_extensions.GetAppId(e)
+	if got == appID {
+		return true
+	}
+
+	v.violation("v1", "stream", "app_id", fmt.Sprintf("requested app %s, received envelope of %s", appID, got))
+	return false
+}
+
+// V2 checks that an envelope matches one of the selectors it was requested
+// with: it must have the selector's source ID, if any, be of the selector's
+// message type, if any, and have the counter or gauge names the selector
+// asks for.
+func (v *Validator) V2(connType string, selectors []*loggregator_v2.Selector, e *loggregator_v2.Envelope) bool {
+	if v == nil {
+		return true
+	}
+
+	var reason, detail string
+	for _, s := range selectors {
+		r, d := mismatch(s, e)
+		if r == "" {
+			return true
+		}
+		if reason == "" || r != "source_id" {
+			reason, detail = r, d
+		}
+	}
+
+	v.violation("v2", connType, reason, detail)
+	return false
+}
+
+// mismatch returns why the envelope does not match the selector, or an
+// empty reason if it does.
+func mismatch(s *loggregator_v2.Selector, e *loggregator_v2.Envelope) (reason, detail string) {
+	if s.GetSourceId() != "" && e.GetSourceId() != s.GetSourceId() {
+		return "source_id", fmt.Sprintf("requested source %s, received envelope of %s", s.GetSourceId(), e.GetSourceId())
+	}
+
+	if want, got := selectorType(s), envelopeType(e); want != "" && want != got {
+		return "message_type", fmt.Sprintf("requested %s envelopes, received %s envelope", want, got)
+	}
+
+	if name := s.GetCounter().GetName(); name != "" && e.GetCounter().GetName() != name {
+		return "name", fmt.Sprintf("requested counter %s, received counter %s", name, e.GetCounter().GetName())
+	}
+
+	for _, name := range s.GetGauge().GetNames() {
+		if _, ok := e.GetGauge().GetMetrics()[name]; !ok {
+			return "name", fmt.Sprintf("requested gauges with %s, received gauge without it", name)
+		}
+	}
+
+	return "", ""
+}
+
+// Violations returns the number of envelopes that did not match.
+func (v *Validator) Violations() uint64 {
+	if v == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&v.violations)
+}
+
+func (v *Validator) violation(version, connType, reason, detail string) {
+	v.batcher.BatchCounter("volley.envelopeViolations").
+		SetTag("version", version).
+		SetTag("conn_type", connType).
+		SetTag("reason", reason).
+		Increment()
+
+	n := atomic.AddUint64(&v.violations, 1)
+	if (n-1)%v.logEvery == 0 {
+		logger.With("version", version).
+			With("conn_type", connType).
+			With("reason", reason).
+			With("violations", n).
+			Warnf("Received unexpected envelope: %s", detail)
+	}
+}
+
+func selectorType(s *loggregator_v2.Selector) string {
+	switch s.GetMessage().(type) {
+	case *loggregator_v2.Selector_Log:
+		return "log"
+	case *loggregator_v2.Selector_Counter:
+		return "counter"
+	case *loggregator_v2.Selector_Gauge:
+		return "gauge"
+	case *loggregator_v2.Selector_Timer:
+		return "timer"
+	case *loggregator_v2.Selector_Event:
+		return "event"
+	default:
+		return ""
+	}
+}
+
+func envelopeType(e *loggregator_v2.Envelope) string {
+	switch {
+	case e.GetLog() != nil:
+		return "log"
+	case e.GetCounter() != nil:
+		return "counter"
+	case e.GetGauge() != nil:
+		return "gauge"
+	case e.GetTimer() != nil:
+		return "timer"
+	case e.GetEvent() != nil:
+		return "event"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,224 @@
+package validate_test
+
+import (
+	"bytes"
+	"logging"
+	"strings"
+	"volley/validate"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/dropsonde/metricbatcher"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validator", func() {
+	var (
+		batcher   *spyBatcher
+		validator *validate.Validator
+		logs      *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		batcher = &spyBatcher{}
+		validator = validate.NewValidator(batcher, 2)
+		logs = &bytes.Buffer{}
+		logging.SetOutput(logs)
+	})
+
+	AfterEach(func() {
+		logging.SetOutput(GinkgoWriter)
+	})
+
+	Describe("V1Stream", func() {
+		It("accepts envelopes of the streamed app", func() {
+			Expect(validator.V1Stream("some-app", v1Log("some-app"))).To(BeTrue())
+			Expect(validator.Violations()).To(BeZero())
+			Expect(batcher.tags).To(BeEmpty())
+		})
+
+		It("counts envelopes of other apps", func() {
+			Expect(validator.V1Stream("some-app", v1Log("other-app"))).To(BeFalse())
+			Expect(validator.Violations()).To(Equal(uint64(1)))
+			Expect(batcher.names).To(ConsistOf("volley.envelopeViolations"))
+			Expect(batcher.tags).To(ConsistOf(map[string]string{
+				"version":   "v1",
+				"conn_type": "stream",
+				"reason":    "app_id",
+			}))
+		})
+	})
+
+	Describe("V2", func() {
+		It("accepts envelopes matching the selector", func() {
+			s := &loggregator_v2.Selector{
+				SourceId: "some-id",
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			}
+			Expect(validator.V2("v2_app_log_stream", []*loggregator_v2.Selector{s}, v2Log("some-id"))).To(BeTrue())
+			Expect(validator.Violations()).To(BeZero())
+		})
+
+		It("accepts any envelope for a firehose", func() {
+			Expect(validator.V2("v2_firehose", []*loggregator_v2.Selector{{}}, v2Counter("some-id"))).To(BeTrue())
+			Expect(validator.V2("v2_firehose", []*loggregator_v2.Selector{{}}, v2Log("other-id"))).To(BeTrue())
+			Expect(validator.Violations()).To(BeZero())
+		})
+
+		It("counts envelopes of other sources", func() {
+			s := &loggregator_v2.Selector{SourceId: "some-id"}
+			Expect(validator.V2("v2_app_stream", []*loggregator_v2.Selector{s}, v2Log("other-id"))).To(BeFalse())
+			Expect(batcher.tags).To(ConsistOf(map[string]string{
+				"version":   "v2",
+				"conn_type": "v2_app_stream",
+				"reason":    "source_id",
+			}))
+		})
+
+		It("counts envelopes that are not logs when logs were selected", func() {
+			s := &loggregator_v2.Selector{
+				SourceId: "some-id",
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			}
+			Expect(validator.V2("v2_app_log_stream", []*loggregator_v2.Selector{s}, v2Counter("some-id"))).To(BeFalse())
+			Expect(batcher.tags).To(ConsistOf(map[string]string{
+				"version":   "v2",
+				"conn_type": "v2_app_log_stream",
+				"reason":    "message_type",
+			}))
+		})
+
+		It("accepts envelopes matching any of several selectors", func() {
+			s := []*loggregator_v2.Selector{{SourceId: "some-id"}, {SourceId: "other-id"}}
+			Expect(validator.V2("v2_multi_source_stream", s, v2Log("other-id"))).To(BeTrue())
+			Expect(validator.V2("v2_multi_source_stream", s, v2Log("third-id"))).To(BeFalse())
+			Expect(batcher.tags).To(ConsistOf(map[string]string{
+				"version":   "v2",
+				"conn_type": "v2_multi_source_stream",
+				"reason":    "source_id",
+			}))
+		})
+
+		It("counts counters without the selected name", func() {
+			s := []*loggregator_v2.Selector{{
+				Message: &loggregator_v2.Selector_Counter{
+					Counter: &loggregator_v2.CounterSelector{Name: "some-counter"},
+				},
+			}}
+			Expect(validator.V2("v2_counter_stream", s, v2Counter("some-id"))).To(BeTrue())
+
+			s[0].GetCounter().Name = "other-counter"
+			Expect(validator.V2("v2_counter_stream", s, v2Counter("some-id"))).To(BeFalse())
+			Expect(batcher.tags).To(ConsistOf(map[string]string{
+				"version":   "v2",
+				"conn_type": "v2_counter_stream",
+				"reason":    "name",
+			}))
+		})
+
+		It("counts gauges without every selected name", func() {
+			s := []*loggregator_v2.Selector{{
+				Message: &loggregator_v2.Selector_Gauge{
+					Gauge: &loggregator_v2.GaugeSelector{Names: []string{"cpu", "memory"}},
+				},
+			}}
+			Expect(validator.V2("v2_gauge_stream", s, v2Gauge("some-id", "cpu", "memory", "disk"))).To(BeTrue())
+			Expect(validator.V2("v2_gauge_stream", s, v2Gauge("some-id", "cpu"))).To(BeFalse())
+			Expect(validator.V2("v2_gauge_stream", s, v2Log("some-id"))).To(BeFalse())
+			Expect(batcher.tags).To(ConsistOf(
+				map[string]string{"version": "v2", "conn_type": "v2_gauge_stream", "reason": "name"},
+				map[string]string{"version": "v2", "conn_type": "v2_gauge_stream", "reason": "message_type"},
+			))
+		})
+	})
+
+	It("logs a sample of the violations", func() {
+		s := &loggregator_v2.Selector{SourceId: "some-id"}
+		for i := 0; i < 5; i++ {
+			validator.V2("v2_app_stream", []*loggregator_v2.Selector{s}, v2Log("other-id"))
+		}
+
+		Expect(validator.Violations()).To(Equal(uint64(5)))
+		Expect(strings.Count(logs.String(), "Received unexpected envelope")).To(Equal(3))
+		Expect(logs.String()).To(ContainSubstring("requested source some-id, received envelope of other-id"))
+	})
+
+	It("accepts every envelope when nil", func() {
+		var v *validate.Validator
+		Expect(v.V1Stream("some-app", v1Log("other-app"))).To(BeTrue())
+		Expect(v.V2("v2_app_stream", []*loggregator_v2.Selector{{SourceId: "some-id"}}, v2Log("other-id"))).To(BeTrue())
+		Expect(v.Violations()).To(BeZero())
+	})
+})
+
+func v1Log(appID string) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("some-origin"),
+		EventType: events.Envelope_LogMessage.Enum(),
+		LogMessage: &events.LogMessage{
+			Message:     []byte("some-message"),
+			MessageType: events.LogMessage_OUT.Enum(),
+			Timestamp:   proto.Int64(1),
+			AppId:       proto.String(appID),
+		},
+	}
+}
+
+func v2Log(sourceID string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{Payload: []byte("some-message")},
+		},
+	}
+}
+
+func v2Counter(sourceID string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: "some-counter"},
+		},
+	}
+}
+
+func v2Gauge(sourceID string, names ...string) *loggregator_v2.Envelope {
+	metrics := make(map[string]*loggregator_v2.GaugeValue)
+	for _, n := range names {
+		metrics[n] = &loggregator_v2.GaugeValue{Unit: "some-unit", Value: 1}
+	}
+
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{Metrics: metrics},
+		},
+	}
+}
+
+type spyBatcher struct {
+	names []string
+	tags  []map[string]string
+}
+
+func (s *spyBatcher) BatchCounter(name string) metricbatcher.BatchCounterChainer {
+	s.names = append(s.names, name)
+	s.tags = append(s.tags, make(map[string]string))
+	return s
+}
+
+func (s *spyBatcher) SetTag(key, value string) metricbatcher.BatchCounterChainer {
+	s.tags[len(s.tags)-1][key] = value
+	return s
+}
+
+func (s *spyBatcher) Increment() {}
+
+func (s *spyBatcher) Add(uint64) {}